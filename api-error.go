@@ -0,0 +1,107 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"net/http"
+	"testing"
+)
+
+// APIError is a S3 error code with its description and the
+// HTTP status code a S3 server responds with.
+// See: https://docs.aws.amazon.com/AmazonS3/latest/API/ErrorResponses.html
+type APIError struct {
+	Code        string
+	Description string
+	StatusCode  int
+}
+
+func (e APIError) Error() string { return e.Code + ": " + e.Description }
+
+// Expect fails the test if err is not a S3 error response
+// with the error code and the HTTP status code of e. It
+// returns the S3 error response for further checks.
+func (e APIError) Expect(t testing.TB, err error) ResponseError {
+	t.Helper()
+	respErr := ExpectError(t, err, e.Code)
+	if respErr.StatusCode != e.StatusCode {
+		t.Fatalf("Error '%s' should have status '%d %s' but has '%d %s'", e.Code, e.StatusCode, http.StatusText(e.StatusCode), respErr.StatusCode, http.StatusText(respErr.StatusCode))
+	}
+	return respErr
+}
+
+// The S3 error codes.
+var (
+	ErrAccessDenied                 = APIError{"AccessDenied", "Access Denied", http.StatusForbidden}
+	ErrAuthorizationHeaderMalformed = APIError{"AuthorizationHeaderMalformed", "The authorization header is malformed - e.g. the region is wrong.", http.StatusBadRequest}
+	ErrBadDigest                    = APIError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	ErrBucketAlreadyExists          = APIError{"BucketAlreadyExists", "The requested bucket name is not available.", http.StatusConflict}
+	ErrBucketAlreadyOwnedByYou      = APIError{"BucketAlreadyOwnedByYou", "The bucket you tried to create already exists, and you own it.", http.StatusConflict}
+	ErrBucketNotEmpty               = APIError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	ErrEntityTooLarge               = APIError{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size.", http.StatusBadRequest}
+	ErrEntityTooSmall               = APIError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	ErrExpiredToken                 = APIError{"ExpiredToken", "The provided token has expired.", http.StatusBadRequest}
+	ErrIllegalLocationConstraint    = APIError{"IllegalLocationConstraintException", "The bucket cannot be created in the specified region.", http.StatusBadRequest}
+	ErrIncompleteBody               = APIError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	ErrInvalidAccessKeyID           = APIError{"InvalidAccessKeyId", "The AWS access key ID you provided does not exist in our records.", http.StatusForbidden}
+	ErrInvalidArgument              = APIError{"InvalidArgument", "Invalid Argument", http.StatusBadRequest}
+	ErrInvalidBucketName            = APIError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	ErrInvalidDigest                = APIError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	ErrInvalidPart                  = APIError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	ErrInvalidPartOrder             = APIError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	ErrInvalidRange                 = APIError{"InvalidRange", "The requested range cannot be satisfied.", http.StatusRequestedRangeNotSatisfiable}
+	ErrInvalidRequest               = APIError{"InvalidRequest", "The request is not valid.", http.StatusBadRequest}
+	ErrInvalidToken                 = APIError{"InvalidToken", "The provided token is malformed or otherwise invalid.", http.StatusBadRequest}
+	ErrKeyTooLong                   = APIError{"KeyTooLongError", "Your key is too long.", http.StatusBadRequest}
+	ErrMalformedXML                 = APIError{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	ErrMethodNotAllowed             = APIError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	ErrMissingContentLength         = APIError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	ErrNoSuchBucket                 = APIError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	ErrNoSuchKey                    = APIError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	ErrNoSuchTagSet                 = APIError{"NoSuchTagSet", "There is no tag set associated with the bucket.", http.StatusNotFound}
+	ErrNoSuchUpload                 = APIError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	ErrNotImplemented               = APIError{"NotImplemented", "A header you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	ErrPermanentRedirect            = APIError{"PermanentRedirect", "The bucket you are attempting to access must be addressed using the specified endpoint.", http.StatusMovedPermanently}
+	ErrPreconditionFailed           = APIError{"PreconditionFailed", "At least one of the preconditions you specified did not hold.", http.StatusPreconditionFailed}
+	ErrSignatureDoesNotMatch        = APIError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	ErrXAmzContentSHA256Mismatch    = APIError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+)
+
+// APIErrors contains all S3 error codes of the catalog.
+var APIErrors = []APIError{
+	ErrAccessDenied,
+	ErrAuthorizationHeaderMalformed,
+	ErrBadDigest,
+	ErrBucketAlreadyExists,
+	ErrBucketAlreadyOwnedByYou,
+	ErrBucketNotEmpty,
+	ErrEntityTooLarge,
+	ErrEntityTooSmall,
+	ErrExpiredToken,
+	ErrIllegalLocationConstraint,
+	ErrIncompleteBody,
+	ErrInvalidAccessKeyID,
+	ErrInvalidArgument,
+	ErrInvalidBucketName,
+	ErrInvalidDigest,
+	ErrInvalidPart,
+	ErrInvalidPartOrder,
+	ErrInvalidRange,
+	ErrInvalidRequest,
+	ErrInvalidToken,
+	ErrKeyTooLong,
+	ErrMalformedXML,
+	ErrMethodNotAllowed,
+	ErrMissingContentLength,
+	ErrNoSuchBucket,
+	ErrNoSuchKey,
+	ErrNoSuchTagSet,
+	ErrNoSuchUpload,
+	ErrNotImplemented,
+	ErrPermanentRedirect,
+	ErrPreconditionFailed,
+	ErrSignatureDoesNotMatch,
+	ErrXAmzContentSHA256Mismatch,
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"crypto/md5"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// TagRunID is the bucket tag key of the ID
+	// of the test run which created the bucket.
+	TagRunID = "s3-test-run-id"
+	// TagRunStart is the bucket tag key of the start
+	// time of the test run which created the bucket.
+	TagRunStart = "s3-test-run-start"
+	// TagRunHost is the bucket tag key of the host
+	// name of the test run which created the bucket.
+	TagRunHost = "s3-test-run-host"
+	// TagRunCommand is the bucket tag key of the
+	// test binary which created the bucket.
+	TagRunCommand = "s3-test-run-command"
+	// TagRunSeed is the bucket tag key of the seed
+	// of the test run which created the bucket.
+	TagRunSeed = "s3-test-run-seed"
+)
+
+// RunID returns the ID of the current test run. All bucket
+// names generated by BucketName contain the run ID such that
+// every bucket of a run can be identified. In contrast to
+// object names and object data, the run ID is not derived
+// from the Seed. It is random and therefore unique for every
+// run - even when a run is reproduced with the same seed.
+func RunID() string {
+	runOnce.Do(func() {
+		var b [4]byte
+		if _, err := io.ReadFull(cryptorand.Reader, b[:]); err != nil {
+			binary.BigEndian.PutUint32(b[:], uint32(time.Now().UnixNano()))
+		}
+		runID, runStart = hex.EncodeToString(b[:]), time.Now().UTC()
+	})
+	return runID
+}
+
+// RunTags returns the metadata of the current test run - i.e.
+// the run ID, the seed, the start time, the host name and the
+// test binary.
+// Config.MakeBucket and Config.TagBucket tag buckets with them.
+func RunTags() map[string]string {
+	id := RunID()
+	tags := map[string]string{
+		TagRunID:      id,
+		TagRunSeed:    strconv.FormatInt(Seed(), 10),
+		TagRunStart:   runStart.Format(time.RFC3339),
+		TagRunCommand: filepath.Base(os.Args[0]),
+	}
+	if host, err := os.Hostname(); err == nil {
+		tags[TagRunHost] = host
+	}
+	return tags
+}
+
+var (
+	runOnce  sync.Once
+	runID    string
+	runStart time.Time
+)
+
+// BucketName returns a bucket name with the given prefix,
+// the run ID and a pseudorandom hex suffix derived from the
+// Seed - e.g. 'test-put-1a2b3c4d-5e6f7a8b'. Since the run ID
+// is unique, runs with the same seed use different buckets.
+//
+// The prefix is normalised such that the bucket name complies
+// with the S3 bucket naming rules: It is converted to lowercase,
+// all characters except letters, digits and hyphens are replaced
+// by hyphens and it is shortened such that the bucket name is
+// at most 63 characters long.
+func BucketName(prefix string) string {
+	suffix := "-" + RunID() + "-" + randomHex(newRand(nextName("bucket/"+prefix)))
+	return normalizeBucketPrefix(prefix, maxBucketNameLength-len(suffix)) + suffix
+}
+
+const (
+	minBucketNameLength = 3
+	maxBucketNameLength = 63
+)
+
+// reservedBucketPrefixes are the prefixes S3 reserves
+// for special bucket names.
+var reservedBucketPrefixes = []string{"xn--", "sthree-", "amzn-s3-demo-"}
+
+// normalizeBucketPrefix returns a bucket name prefix with
+// at most maxLength characters which contains only lowercase
+// letters, digits and hyphens and starts with a letter
+// or digit.
+func normalizeBucketPrefix(prefix string, maxLength int) string {
+	normalized := []byte(strings.ToLower(prefix))
+	for i, c := range normalized {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			normalized[i] = '-'
+		}
+	}
+	prefix = strings.TrimLeft(string(normalized), "-")
+	for trimmed := ""; trimmed != prefix; { // Removing a reserved prefix may expose another one - e.g. 'sthree-xn--'
+		trimmed = prefix
+		for _, reserved := range reservedBucketPrefixes {
+			prefix = strings.TrimLeft(strings.TrimPrefix(prefix, reserved), "-")
+		}
+	}
+	if len(prefix) > maxLength {
+		prefix = prefix[:maxLength]
+	}
+	if prefix = strings.TrimRight(prefix, "-"); prefix == "" {
+		return "test"
+	}
+	return prefix
+}
+
+// ValidateBucketName returns an error if the bucket name
+// violates the S3 bucket naming rules - e.g. because it is
+// too long or contains uppercase characters.
+// See: https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html
+func ValidateBucketName(bucket string) error {
+	if len(bucket) < minBucketNameLength || len(bucket) > maxBucketNameLength {
+		return errors.New("Invalid bucket name '" + bucket + "': must be between 3 and 63 characters long")
+	}
+	for i := 0; i < len(bucket); i++ {
+		if c := bucket[i]; !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return errors.New("Invalid bucket name '" + bucket + "': must consist of lowercase letters, digits, dots and hyphens only")
+		}
+	}
+	if first, last := bucket[0], bucket[len(bucket)-1]; first == '.' || first == '-' || last == '.' || last == '-' {
+		return errors.New("Invalid bucket name '" + bucket + "': must begin and end with a letter or digit")
+	}
+	if strings.Contains(bucket, "..") {
+		return errors.New("Invalid bucket name '" + bucket + "': must not contain two adjacent dots")
+	}
+	if net.ParseIP(bucket) != nil {
+		return errors.New("Invalid bucket name '" + bucket + "': must not be formatted as IP address")
+	}
+	for _, prefix := range reservedBucketPrefixes {
+		if strings.HasPrefix(bucket, prefix) {
+			return errors.New("Invalid bucket name '" + bucket + "': must not start with '" + prefix + "'")
+		}
+	}
+	for _, suffix := range []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3"} {
+		if strings.HasSuffix(bucket, suffix) {
+			return errors.New("Invalid bucket name '" + bucket + "': must not end with '" + suffix + "'")
+		}
+	}
+	return nil
+}
+
+// MakeBucket creates the bucket at the location and tags it with
+// the metadata of the current test run. See: RunTags
+//
+// MakeBucket sends plain HTTP requests. Tagging is best-effort: If
+// the bucket cannot be tagged, MakeBucket logs the error - unless
+// the server does not implement bucket tagging - and keeps the
+// bucket. It can be passed to MakeBucketAt as make function.
+func (c *Config) MakeBucket(bucket, location string) error {
+	if err := ValidateBucketName(bucket); err != nil {
+		return err
+	}
+	client, err := c.rawClient()
+	if err != nil {
+		return err
+	}
+	defer client.CloseIdleConnections()
+
+	var body []byte
+	if location != "" && location != DefaultRegion {
+		body, _ = xml.Marshal(struct {
+			XMLName            xml.Name `xml:"CreateBucketConfiguration"`
+			LocationConstraint string   `xml:"LocationConstraint"`
+		}{LocationConstraint: location})
+	}
+	resp, err := c.send(client, Request{Method: http.MethodPut, Bucket: bucket, Body: body})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if err = c.tagBucket(client, bucket); err != nil && !isAPIError(err, ErrNotImplemented) {
+		log.Printf("s3: Failed to tag bucket '%s': %v", bucket, err)
+	}
+	return nil
+}
+
+// TagBucket tags the bucket with the metadata of the current
+// test run - e.g. after creating it with a Store. See: RunTags
+//
+// Tagging is best-effort: TagBucket logs tagging errors - unless
+// the server does not implement bucket tagging - but does not
+// fail the test.
+func (c *Config) TagBucket(t testing.TB, bucket string) {
+	client, err := c.rawClient()
+	if err != nil {
+		t.Logf("Failed to tag bucket '%s': %v", bucket, err)
+		return
+	}
+	defer client.CloseIdleConnections()
+
+	if err = c.tagBucket(client, bucket); err != nil && !isAPIError(err, ErrNotImplemented) {
+		t.Logf("Failed to tag bucket '%s': %v", bucket, err)
+	}
+}
+
+// tagBucket replaces the tags of the bucket with RunTags.
+func (c *Config) tagBucket(client *http.Client, bucket string) error {
+	type tag struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	}
+	tagging := struct {
+		XMLName xml.Name `xml:"Tagging"`
+		Tags    []tag    `xml:"TagSet>Tag"`
+	}{}
+	for key, value := range RunTags() {
+		tagging.Tags = append(tagging.Tags, tag{key, value})
+	}
+	body, _ := xml.Marshal(tagging)
+	sum := md5.Sum(body)
+	resp, err := c.send(client, Request{
+		Method: http.MethodPut,
+		Bucket: bucket,
+		Query:  url.Values{"tagging": {""}},
+		Header: http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}},
+		Body:   body,
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// BucketMaker creates buckets. It is implemented by every
+// Store and by minio-go clients. See: Config.MakeTestBucket
+type BucketMaker interface {
+	// BucketExists returns true if the bucket exists.
+	BucketExists(bucket string) (bool, error)
+	// MakeBucket creates a new bucket at the location.
+	MakeBucket(bucket, location string) error
+}
+
+// MakeTestBucket creates the bucket at the Region of the config
+// using the BucketMaker - unless the bucket exists already - and
+// tags it with the metadata of the current test run. It fails the
+// test if the bucket cannot be created.
+//
+// If MakeTestBucket has created the bucket, it removes the bucket
+// - including all objects within it - once the test and all its
+// subtests have completed. See: MakeBucketAt, TagBucket and
+// ForceRemoveBucket
+func (c *Config) MakeTestBucket(t testing.TB, maker BucketMaker, bucket string) {
+	t.Helper()
+	remove, err := MakeBucketAt(bucket, c.Region, maker.BucketExists, maker.MakeBucket, c.ForceRemoveBucket)
+	if err != nil {
+		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
+	}
+	t.Cleanup(func() { remove(t) })
+	c.TagBucket(t, bucket)
+}
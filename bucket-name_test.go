@@ -0,0 +1,203 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var bucketNameTests = []struct {
+	Prefix string
+	Want   string // The expected prefix of the bucket name.
+}{
+	{Prefix: "test-put", Want: "test-put-"},                                    // 0
+	{Prefix: "Test_Encrypted.Put", Want: "test-encrypted-put-"},                // 1
+	{Prefix: "--test--", Want: "test-"},                                        // 2
+	{Prefix: "xn--test", Want: "test-"},                                        // 3
+	{Prefix: "", Want: "test-"},                                                // 4
+	{Prefix: "!!!", Want: "test-"},                                             // 5
+	{Prefix: "192.168.1.1", Want: "192-168-1-1-"},                              // 6
+	{Prefix: strings.Repeat("a", 100), Want: strings.Repeat("a", 45) + "-"},    // 7
+	{Prefix: strings.Repeat("ab-", 15) + "c", Want: strings.Repeat("ab-", 15)}, // 8
+	{Prefix: "xn---foo", Want: "foo-"},                                         // 9
+	{Prefix: "sthree-xn--foo", Want: "foo-"},                                   // 10
+}
+
+func TestBucketName(t *testing.T) {
+	for i, test := range bucketNameTests {
+		bucket := s3.BucketName(test.Prefix)
+		if err := s3.ValidateBucketName(bucket); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if !strings.HasPrefix(bucket, test.Want) {
+			t.Fatalf("Test %d: Bucket name '%s' does not start with '%s'", i, bucket, test.Want)
+		}
+		if !strings.Contains(bucket, "-"+s3.RunID()+"-") {
+			t.Fatalf("Test %d: Bucket name '%s' does not contain the run ID '%s'", i, bucket, s3.RunID())
+		}
+	}
+	if a, b := s3.BucketName("test"), s3.BucketName("test"); a == b {
+		t.Fatalf("BucketName returned the same name twice: '%s'", a)
+	}
+}
+
+var validateBucketNameTests = []struct {
+	Bucket string
+	Valid  bool
+}{
+	{Bucket: "my-bucket", Valid: true},              // 0
+	{Bucket: "my.bucket.1", Valid: true},            // 1
+	{Bucket: "abc", Valid: true},                    // 2
+	{Bucket: "ab", Valid: false},                    // 3
+	{Bucket: strings.Repeat("a", 64), Valid: false}, // 4
+	{Bucket: "My-Bucket", Valid: false},             // 5
+	{Bucket: "my_bucket", Valid: false},             // 6
+	{Bucket: "-my-bucket", Valid: false},            // 7
+	{Bucket: "my-bucket.", Valid: false},            // 8
+	{Bucket: "my..bucket", Valid: false},            // 9
+	{Bucket: "192.168.5.4", Valid: false},           // 10
+	{Bucket: "xn--my-bucket", Valid: false},         // 11
+	{Bucket: "my-bucket-s3alias", Valid: false},     // 12
+	{Bucket: "my-bucket--ol-s3", Valid: false},      // 13
+}
+
+func TestValidateBucketName(t *testing.T) {
+	for i, test := range validateBucketNameTests {
+		if err := s3.ValidateBucketName(test.Bucket); err == nil && !test.Valid {
+			t.Fatalf("Test %d: Bucket name '%s' should be invalid", i, test.Bucket)
+		} else if err != nil && test.Valid {
+			t.Fatalf("Test %d: Bucket name '%s' should be valid: %v", i, test.Bucket, err)
+		}
+	}
+}
+
+func TestConfigMakeBucket(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket := s3.BucketName("test-make-bucket")
+	if err := config.MakeBucket(bucket, region); err != nil {
+		t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+	}
+	defer s3.RemoveBucket(bucket, config.ForceRemoveBucket, t)
+
+	tags, err := store.GetBucketTagging(bucket)
+	if err != nil {
+		t.Fatalf("Failed to get tags of bucket '%s': %v", bucket, err)
+	}
+	for key, value := range s3.RunTags() {
+		if tags[key] != value {
+			t.Fatalf("Tag '%s' mismatch: got '%s' - want '%s'", key, tags[key], value)
+		}
+	}
+	if err = config.MakeBucket("Invalid_Bucket", region); err == nil {
+		t.Fatal("Creating a bucket with an invalid name should fail but succeeded")
+	}
+
+	// Tagging is best-effort. Buckets which cannot be tagged are kept.
+	config.WrapTransport = func(transport http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if _, ok := req.URL.Query()["tagging"]; ok && req.Method == http.MethodPut {
+				return &http.Response{
+					StatusCode: http.StatusForbidden,
+					Header:     http.Header{"Content-Type": {"application/xml"}},
+					Body:       ioutil.NopCloser(strings.NewReader("<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")),
+					Request:    req,
+				}, nil
+			}
+			return transport.RoundTrip(req)
+		})
+	}
+	bucket = s3.BucketName("test-make-bucket")
+	if err = config.MakeBucket(bucket, region); err != nil {
+		t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+	}
+	defer s3.RemoveBucket(bucket, config.ForceRemoveBucket, t)
+	if ok, err := store.BucketExists(bucket); !ok || err != nil {
+		t.Fatalf("Bucket '%s' has been removed since it could not be tagged - err: %v", bucket, err)
+	}
+}
+
+func TestConfigTagBucket(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket := s3.BucketName("test-tag-bucket")
+	if err := store.MakeBucket(bucket, region); err != nil {
+		t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+	}
+	defer s3.RemoveBucket(bucket, config.ForceRemoveBucket, t)
+	config.TagBucket(t, bucket)
+
+	tags, err := store.GetBucketTagging(bucket)
+	if err != nil {
+		t.Fatalf("Failed to get tags of bucket '%s': %v", bucket, err)
+	}
+	if tags[s3.TagRunID] != s3.RunID() {
+		t.Fatalf("Tag '%s' mismatch: got '%s' - want '%s'", s3.TagRunID, tags[s3.TagRunID], s3.RunID())
+	}
+}
+
+func TestConfigMakeTestBucket(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket := s3.BucketName("test-make-test-bucket")
+	t.Run("make", func(t *testing.T) {
+		config.MakeTestBucket(t, store, bucket)
+
+		tags, err := store.GetBucketTagging(bucket)
+		if err != nil {
+			t.Fatalf("Failed to get tags of bucket '%s': %v", bucket, err)
+		}
+		if tags[s3.TagRunID] != s3.RunID() {
+			t.Fatalf("Tag '%s' mismatch: got '%s' - want '%s'", s3.TagRunID, tags[s3.TagRunID], s3.RunID())
+		}
+		data := []byte("Hello World")
+		if _, err = store.PutObject(bucket, s3.ObjectName("object"), bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to upload object: %v", err)
+		}
+	})
+	if ok, err := store.BucketExists(bucket); ok || err != nil {
+		t.Fatalf("Bucket '%s' has not been removed after the test completed - err: %v", bucket, err)
+	}
+}
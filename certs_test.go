@@ -0,0 +1,81 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+func TestGenerateCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-certs")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rootCAs, err := s3.GenerateCerts(filepath.Join(dir, "certs"))
+	if err != nil {
+		t.Fatalf("Failed to generate certificates: %s", err)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "certs", s3.PublicCertFile), filepath.Join(dir, "certs", s3.PrivateKeyFile))
+	if err != nil {
+		t.Fatalf("Failed to load generated certificate: %s", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to parse server address: %s", err)
+	}
+
+	var tests = []struct {
+		Config s3.Config
+		Host   string
+	}{
+		{Config: s3.Config{RootCAs: rootCAs}, Host: "127.0.0.1"},                                       // 0
+		{Config: s3.Config{RootCAs: rootCAs}, Host: "localhost"},                                       // 1
+		{Config: s3.Config{RootCAs: rootCAs}, Host: "::1"},                                             // 2
+		{Config: s3.Config{CACert: filepath.Join(dir, "certs", s3.PublicCertFile)}, Host: "localhost"}, // 3
+		{Config: s3.Config{RootCAs: rootCAs}, Host: "bucket.localhost"},                                // 4
+	}
+	for i, test := range tests {
+		transport, err := test.Config.Transport()
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create transport: %s", i, err)
+		}
+		// Connect to the server listening on 127.0.0.1 but verify
+		// the certificate for the test host.
+		transport.TLSClientConfig.ServerName = test.Host
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + net.JoinHostPort("127.0.0.1", port))
+		if err != nil {
+			t.Errorf("Test %d: Failed to verify certificate for '%s': %s", i, test.Host, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+
+	// The certificate must not be valid for other hosts.
+	transport, err := (&s3.Config{RootCAs: rootCAs}).Transport()
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	transport.TLSClientConfig.ServerName = "example.com"
+	if resp, err := (&http.Client{Transport: transport}).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("Certificate is valid for 'example.com'")
+	}
+}
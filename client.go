@@ -0,0 +1,83 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"net/http"
+	"testing"
+
+	minio "github.com/minio/minio-go"
+)
+
+// NewClient returns a new minio-go client for the DefaultTarget
+// specified by the command line arguments. It fails the test if
+// the command line arguments cannot be parsed or the client cannot
+// be created. See: Config.NewClient
+func NewClient(t testing.TB) *minio.Client {
+	targets, err := Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, ok := targets[DefaultTarget]
+	if !ok {
+		t.Fatalf("No S3 target '%s' is specified", DefaultTarget)
+	}
+	return config.NewClient(t)
+}
+
+// NewClient returns a new minio-go client for the endpoint.
+// The client uses the credentials, the addressing style, the TLS
+// configuration and the transport hook of the config. It fails
+// the test if the client cannot be created.
+func (c *Config) NewClient(t testing.TB) *minio.Client {
+	lookup := minio.BucketLookupPath
+	if c.Addressing == AddressingVirtualHost {
+		lookup = minio.BucketLookupDNS
+	}
+	client, err := minio.NewWithOptions(c.Endpoint, &minio.Options{
+		Creds:        c.MinioCredentials(),
+		Secure:       c.Secure(),
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client for '%s': %v", c.Endpoint, err)
+	}
+	client.SetCustomTransport(c.roundTripper(t))
+	return client
+}
+
+// roundTripper returns the HTTP transport for the endpoint
+// wrapped by the transport hook of the config - if any. If the
+// config specifies a signature scheme, requests are re-signed
+// before passing them to the transport hook. It fails the test
+// if the transport cannot be created.
+func (c *Config) roundTripper(t testing.TB) http.RoundTripper {
+	transport, err := c.wrappedTransport()
+	if err != nil {
+		t.Fatalf("Failed to create transport for '%s': %v", c.Endpoint, err)
+	}
+	return c.newSigner(transport)
+}
+
+// wrappedTransport returns the HTTP transport for the endpoint
+// wrapped by the transport hook of the config - if any.
+func (c *Config) wrappedTransport() (http.RoundTripper, error) {
+	transport, err := c.Transport()
+	if err != nil {
+		return nil, err
+	}
+	if c.WrapTransport != nil {
+		return c.WrapTransport(transport), nil
+	}
+	return transport, nil
+}
+
+// RequireTLS skips the test if TLS is disabled for
+// the endpoint.
+func (c *Config) RequireTLS(t testing.TB) {
+	if c.NoTLS {
+		t.Skip("Skipping test because TLS is disabled")
+	}
+}
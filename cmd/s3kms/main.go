@@ -0,0 +1,95 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Command s3kms runs a local KES-compatible KMS such that a local
+// S3 server - e.g. minio - supports SSE-KMS without a real KMS.
+//
+// Usage:
+//
+//	s3kms [-addr 127.0.0.1:7373] [-certs ~/.minio/certs] [-key my-key] [-secret <hex>]
+//
+// The KMS serves TLS using the private key and certificate generated
+// by s3test-certs. It prints the env. variables which configure minio
+// to use the KMS. Run the S3 tests with: '-kms-key my-key'.
+//
+// The master keys are derived from the secret. If no secret is
+// specified, the secret is derived from the TLS private key such
+// that restarting the KMS keeps existing objects decryptable.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/aead/s3"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:7373", "The address the KMS listens on.")
+	certs := flag.String("certs", filepath.Join(homeDir(), ".minio", "certs"), "The directory containing the TLS private key and certificate.")
+	key := flag.String("key", "my-key", "The name of the default master key.")
+	secret := flag.String("secret", "", "The hex-encoded secret the master keys are derived from. Default: derived from the TLS private key")
+	flag.Parse()
+
+	keyFile, certFile := filepath.Join(*certs, s3.PrivateKeyFile), filepath.Join(*certs, s3.PublicCertFile)
+	privateKey, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read TLS private key: %v\n", err)
+		os.Exit(1)
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load TLS certificate: %v\n", err)
+		os.Exit(1)
+	}
+
+	var kmsSecret []byte
+	if *secret != "" {
+		if kmsSecret, err = hex.DecodeString(*secret); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid secret: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		sum := sha256.Sum256(privateKey)
+		kmsSecret = sum[:]
+	}
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: s3.NewKMS(kmsSecret, *key),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientAuth:   tls.RequestClientCert, // KES clients send a certificate but the KMS does not verify it
+		},
+	}
+
+	fmt.Printf("KMS listening on: https://%s\n", *addr)
+	fmt.Println("\nRun minio with:")
+	fmt.Printf("  export MINIO_KMS_KES_ENDPOINT=https://%s\n", *addr)
+	fmt.Printf("  export MINIO_KMS_KES_KEY_FILE=%s\n", keyFile)
+	fmt.Printf("  export MINIO_KMS_KES_CERT_FILE=%s\n", certFile)
+	fmt.Printf("  export MINIO_KMS_KES_CAPATH=%s\n", certFile)
+	fmt.Printf("  export MINIO_KMS_KES_KEY_NAME=%s\n", *key)
+	fmt.Printf("\nRun the S3 tests with: -kms-key=%s\n", *key)
+
+	if err = server.ListenAndServeTLS("", ""); err != nil {
+		fmt.Fprintf(os.Stderr, "KMS stopped: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func homeDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("USERPROFILE")
+	}
+	return os.Getenv("HOME")
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Command s3sweep removes test buckets left behind on a S3 server -
+// e.g. by crashed test runs. It selects all buckets tagged with a
+// test run ID which start with the given prefix or belong to the
+// given test run and are older than the given age. Buckets without
+// any tags - e.g. on servers which don't implement bucket tagging -
+// are selected by names generated by s3.BucketName instead.
+// See: s3.Sweep
+//
+// Usage:
+//
+//	s3sweep [-age 24h] [-prefix test-] [-run <run-id>] [-delete] -server <endpoint> -access <key> -secret <key>
+//
+// Either -prefix or -run is required. By default, s3sweep only lists
+// the selected buckets. With -delete it removes them, including all
+// objects within them. s3sweep accepts the same S3 flags and env.
+// variables as the S3 tests - e.g. '-server', '-access', '-secret'
+// and '-config'.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aead/s3"
+)
+
+func main() {
+	age := flag.Duration("age", 24*time.Hour, "Select only buckets created more than this duration ago.")
+	prefix := flag.String("prefix", "", "Select only buckets with names starting with this prefix - e.g. 'test-'.")
+	runID := flag.String("run", "", "Select only buckets of the test run with this ID - i.e. tagged with it.")
+	remove := flag.Bool("delete", false, "Remove the selected buckets. Without -delete the buckets are only listed.")
+	s3.RegisterFlags(flag.CommandLine, "")
+	flag.Parse()
+
+	if *prefix == "" && *runID == "" {
+		fmt.Fprintln(os.Stderr, "Either -prefix or -run is required")
+		os.Exit(2)
+	}
+	targets, err := s3.Parse()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse S3 targets: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	failed := false
+	for _, name := range targets.Names() {
+		config := targets[name]
+		store, err := config.HTTPStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Failed to create store: %v\n", name, err)
+			failed = true
+			continue
+		}
+
+		buckets, err := s3.Sweep(ctx, store, s3.SweepOptions{
+			Prefix:    *prefix,
+			RunID:     *runID,
+			OlderThan: *age,
+			DryRun:    !*remove,
+			Remove:    config.ForceRemoveBucket,
+		})
+		for _, bucket := range buckets {
+			if *remove {
+				fmt.Printf("%s: Removed bucket '%s'\n", name, bucket)
+			} else {
+				fmt.Printf("%s: Would remove bucket '%s'\n", name, bucket)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Failed to sweep buckets: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
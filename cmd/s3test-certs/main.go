@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Command s3test-certs generates a private key and a self-signed
+// TLS certificate for a local S3 server - e.g. minio.
+//
+// Usage:
+//
+//	s3test-certs [-dir ~/.minio/certs]
+//
+// The generated certificate is valid for 'localhost', '*.localhost',
+// '127.0.0.1' and '::1'. The S3 tests can verify the server certificate by
+// specifying it as CA certificate: '-cacert ~/.minio/certs/public.crt'.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/aead/s3"
+)
+
+func main() {
+	dir := flag.String("dir", filepath.Join(homeDir(), ".minio", "certs"), "The directory to write the private key and certificate to.")
+	flag.Parse()
+
+	if _, err := s3.GenerateCerts(*dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate TLS certificate: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Private key: %s\n", filepath.Join(*dir, s3.PrivateKeyFile))
+	fmt.Printf("Certificate: %s\n", filepath.Join(*dir, s3.PublicCertFile))
+	fmt.Printf("\nRun the S3 tests with: -cacert=%s\n", filepath.Join(*dir, s3.PublicCertFile))
+}
+
+func homeDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("USERPROFILE")
+	}
+	return os.Getenv("HOME")
+}
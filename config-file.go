@@ -0,0 +1,217 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Optional S3 features which can be disabled for a target.
+const (
+	FeatureSSES3        = "sse-s3"
+	FeatureSSEC         = "sse-c"
+	FeatureSSEKMS       = "sse-kms"
+	FeatureStorageClass = "storage-class"
+
+	// FeatureRegion indicates that the server rejects requests
+	// signed for or sent to the wrong region. Single-region
+	// servers which accept any region should disable it.
+	FeatureRegion = "region"
+)
+
+// Features is a set of optional S3 features. A feature
+// is considered to be supported by a target unless it
+// is disabled explicitly.
+type Features map[string]bool
+
+// Enabled returns true if the feature is not disabled.
+func (f Features) Enabled(feature string) bool {
+	enabled, ok := f[feature]
+	return !ok || enabled
+}
+
+// configFile is the on-disk representation of Targets.
+// It can be either encoded as JSON or as YAML document.
+//
+// An example YAML config file:
+//
+//	targets:
+//	  minio:
+//	    endpoint: localhost:9000
+//	    addressing: both
+//	    signature: all
+//	    access_key: my-access-key
+//	    secret_key: my-secret-key
+//	    tls:
+//	      ca: /etc/ssl/private-ca.pem
+//	      cert: client.crt
+//	      key: client.key
+//	    size: 32KiB
+//	    multipart_size: 65MiB
+//	    sizes: 0,1,5MiB-1,5MiB,5MiB+1
+//	    features:
+//	      sse-kms: false
+//	  aws:
+//	    endpoint: s3.eu-west-1.amazonaws.com
+//	    region: eu-west-1
+//	    profile: dev
+//	    kms_key: 1234abcd-12ab-34cd-56ef-1234567890ab
+//	    sts:
+//	      endpoint: https://sts.amazonaws.com
+//	      role_arn: arn:aws:iam::123456789012:role/s3-test
+//	      duration_seconds: 3600
+type configFile struct {
+	Targets map[string]targetConfig `json:"targets" yaml:"targets"`
+}
+
+type targetConfig struct {
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Region   string `json:"region" yaml:"region"`
+
+	Addressing Addressing `json:"addressing" yaml:"addressing"`
+	Signature  Signature  `json:"signature" yaml:"signature"`
+
+	AccessKey string `json:"access_key" yaml:"access_key"`
+	SecretKey string `json:"secret_key" yaml:"secret_key"`
+	Token     string `json:"session_token" yaml:"session_token"`
+	Profile   string `json:"profile" yaml:"profile"`
+
+	TLS struct {
+		Insecure bool   `json:"insecure" yaml:"insecure"`
+		Disabled bool   `json:"disabled" yaml:"disabled"`
+		CACert   string `json:"ca" yaml:"ca"`
+		Cert     string `json:"cert" yaml:"cert"`
+		Key      string `json:"key" yaml:"key"`
+	} `json:"tls" yaml:"tls"`
+
+	Size          sizeValue  `json:"size" yaml:"size"`
+	MultipartSize sizeValue  `json:"multipart_size" yaml:"multipart_size"`
+	Sizes         sizesValue `json:"sizes" yaml:"sizes"`
+
+	KMSKeyID string `json:"kms_key" yaml:"kms_key"`
+
+	Features Features `json:"features" yaml:"features"`
+
+	STS stsConfig `json:"sts" yaml:"sts"`
+}
+
+func (c *targetConfig) toConfig() Config {
+	return Config{
+		Endpoint:      c.Endpoint,
+		Region:        c.Region,
+		Addressing:    c.Addressing,
+		Signature:     c.Signature,
+		AccessKey:     c.AccessKey,
+		SecretKey:     c.SecretKey,
+		SessionToken:  c.Token,
+		Insecure:      c.TLS.Insecure,
+		NoTLS:         c.TLS.Disabled,
+		CACert:        c.TLS.CACert,
+		ClientCert:    c.TLS.Cert,
+		ClientKey:     c.TLS.Key,
+		Size:          int64(c.Size),
+		MultipartSize: int64(c.MultipartSize),
+		Sizes:         []int64(c.Sizes),
+		KMSKeyID:      c.KMSKeyID,
+		Features:      c.Features,
+	}
+}
+
+// LoadConfig reads the targets from the config file at path.
+// Targets which specify an AWS profile instead of an access key
+// and secret key use the credentials of this profile. See:
+// SharedCredentials. Targets which specify a 'sts' section
+// obtain temporary credentials from a STS endpoint.
+// Files with a '.json' extension are parsed as JSON documents.
+// All other files are parsed as YAML documents. Unknown fields
+// are rejected in both formats.
+func LoadConfig(path string) (Targets, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file configFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	} else {
+		err = yaml.UnmarshalStrict(data, &file)
+	}
+	if err != nil {
+		return nil, errors.New("Failed to parse config file '" + path + "': " + err.Error())
+	}
+
+	targets := make(Targets, len(file.Targets))
+	for name, target := range file.Targets {
+		config := target.toConfig()
+		if target.Profile != "" && config.AccessKey == "" && config.SecretKey == "" {
+			creds, err := SharedCredentials(target.Profile)
+			if err != nil {
+				return nil, errors.New("Target '" + name + "': " + err.Error())
+			}
+			config.AccessKey, config.SecretKey, config.SessionToken = creds.AccessKey, creds.SecretKey, creds.SessionToken
+		}
+		if target.STS.enabled() {
+			if config.Provider, err = target.STS.provider(&config); err != nil {
+				return nil, errors.New("Target '" + name + "': " + err.Error())
+			}
+		}
+		config.setDefaults()
+		targets[name] = config
+	}
+	if err = targets.Validate(); err != nil {
+		return nil, errors.New("Invalid config file '" + path + "': " + err.Error())
+	}
+	return targets, nil
+}
+
+// UnmarshalJSON parses a size either from a JSON number or from
+// a JSON string with an optional unit suffix - e.g. "64MiB". See: ParseSize
+func (sv *sizeValue) UnmarshalJSON(b []byte) error {
+	if s, err := strconv.Unquote(string(b)); err == nil {
+		return sv.Set(s)
+	}
+	return sv.Set(string(b))
+}
+
+// UnmarshalYAML parses a size from a YAML scalar with an
+// optional unit suffix - e.g. 64MiB. See: ParseSize
+func (sv *sizeValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return sv.Set(s)
+}
+
+// UnmarshalJSON parses a list of sizes from a JSON string
+// of comma-separated sizes - e.g. "0,1,5MiB+1".
+func (sv *sizesValue) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return errors.New("Invalid sizes " + string(b) + ": expected a string of comma-separated sizes")
+	}
+	return sv.Set(s)
+}
+
+// UnmarshalYAML parses a list of sizes from a YAML scalar
+// of comma-separated sizes - e.g. 0,1,5MiB+1.
+func (sv *sizesValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return sv.Set(s)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var loadConfigTests = []struct {
+	File       string
+	Content    string
+	Targets    s3.Targets
+	ShouldFail bool
+}{
+	{ // 0
+		File: "config.json",
+		Content: `{
+			"targets": {
+				"minio": {
+					"endpoint": "localhost:9000",
+					"access_key": "my-access-key",
+					"secret_key": "my-secret-key",
+					"tls": { "insecure": true },
+					"size": "64KiB",
+					"multipart_size": 1048576,
+					"features": { "sse-kms": false }
+				}
+			}
+		}`,
+		Targets: s3.Targets{
+			"minio": s3.Config{
+				Endpoint:      "localhost:9000",
+				AccessKey:     "my-access-key",
+				SecretKey:     "my-secret-key",
+				Insecure:      true,
+				Size:          64 * 1024,
+				MultipartSize: 1024 * 1024,
+				Features:      s3.Features{s3.FeatureSSEKMS: false},
+			},
+		},
+	},
+	{ // 1
+		File: "config.yaml",
+		Content: `
+targets:
+  minio:
+    endpoint: localhost:9000
+    access_key: my-access-key
+    secret_key: my-secret-key
+    tls:
+      disabled: true
+  aws:
+    endpoint: s3.amazonaws.com
+    region: eu-central-1
+    access_key: aws-access-key
+    secret_key: aws-secret-key
+    size: 1MB
+    multipart_size: 128MiB
+    sizes: 0, 5MiB+1
+    kms_key: 1234abcd-12ab-34cd-56ef-1234567890ab
+`,
+		Targets: s3.Targets{
+			"minio": s3.Config{
+				Endpoint:      "localhost:9000",
+				AccessKey:     "my-access-key",
+				SecretKey:     "my-secret-key",
+				NoTLS:         true,
+				Size:          s3.DefaultSize,
+				MultipartSize: s3.DefaultMultipartSize,
+			},
+			"aws": s3.Config{
+				Endpoint:      "s3.amazonaws.com",
+				Region:        "eu-central-1",
+				AccessKey:     "aws-access-key",
+				SecretKey:     "aws-secret-key",
+				Size:          1024 * 1024,
+				MultipartSize: 128 * 1024 * 1024,
+				Sizes:         []int64{0, 5<<20 + 1},
+				KMSKeyID:      "1234abcd-12ab-34cd-56ef-1234567890ab",
+			},
+		},
+	},
+	{File: "config.yml", Content: "targets:\n  minio:\n    endpoint: localhost:9000\n", ShouldFail: true},                                                                                                               // 2 Missing credentials
+	{File: "config.yml", Content: "targets:\n  minio:\n    endpoint: localhost:9000\n    unknown: true\n", ShouldFail: true},                                                                                            // 3 Unknown field
+	{File: "config.json", Content: `{"targets": {}}`, ShouldFail: true},                                                                                                                                                 // 4 No targets
+	{File: "config.json", Content: `{"targets": {"a": {"endpoint": "e", "access_key": "a", "secret_key": "s", "size": "1XB"}}}`, ShouldFail: true},                                                                      // 5 Invalid size
+	{File: "config.json", Content: `{"targets": {"a": {"endpoint": "e", "access_key": "a", "secret_key": "s", "unknown": true}}}`, ShouldFail: true},                                                                    // 6 Unknown field
+	{File: "config.yml", Content: "targets:\n  minio:\n    endpoint: localhost:9000\n    access_key: a\n    secret_key: s\n    signature: v5\n    sts:\n      role_arn: arn:minio:iam:::role/test\n", ShouldFail: true}, // 7 Unknown signature with STS
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-config")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range loadConfigTests {
+		path := filepath.Join(dir, test.File)
+		if err = ioutil.WriteFile(path, []byte(test.Content), 0600); err != nil {
+			t.Fatalf("Test %d: Failed to write config file: %s", i, err)
+		}
+		targets, err := s3.LoadConfig(path)
+		if err != nil && !test.ShouldFail {
+			t.Errorf("Test %d: Failed to load config file: %s", i, err)
+			continue
+		}
+		if err == nil && test.ShouldFail {
+			t.Errorf("Test %d: Loading config file should fail but succeeded", i)
+			continue
+		}
+		if !test.ShouldFail && !reflect.DeepEqual(targets, test.Targets) {
+			t.Errorf("Test %d: Targets mismatch: got %v - want %v", i, targets, test.Targets)
+		}
+	}
+}
+
+func TestFeaturesEnabled(t *testing.T) {
+	features := s3.Features{s3.FeatureSSEC: true, s3.FeatureSSEKMS: false}
+	if !features.Enabled(s3.FeatureSSEC) {
+		t.Errorf("Feature '%s' is enabled explicitly but reported as disabled", s3.FeatureSSEC)
+	}
+	if features.Enabled(s3.FeatureSSEKMS) {
+		t.Errorf("Feature '%s' is disabled explicitly but reported as enabled", s3.FeatureSSEKMS)
+	}
+	if !features.Enabled(s3.FeatureStorageClass) {
+		t.Errorf("Feature '%s' is not disabled but reported as disabled", s3.FeatureStorageClass)
+	}
+}
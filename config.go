@@ -0,0 +1,323 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/minio/minio-go/pkg/credentials"
+)
+
+const (
+	// DefaultSize is the default object size for single part operations.
+	DefaultSize = 32 * 1024
+	// DefaultMultipartSize is the default object size for multipart operations.
+	DefaultMultipartSize = 65 * 1024 * 1024
+)
+
+// Addressing is the style used to address buckets in S3 requests.
+type Addressing string
+
+const (
+	// AddressingPath addresses buckets as part of the
+	// URL path - e.g. 'https://localhost:9000/bucket/object'.
+	AddressingPath Addressing = "path"
+	// AddressingVirtualHost addresses buckets as subdomain
+	// of the endpoint - e.g. 'https://bucket.localhost:9000/object'.
+	AddressingVirtualHost Addressing = "virtual-host"
+	// AddressingBoth runs every test once with path-style and
+	// once with virtual-host-style addressing. See: Targets.Run
+	AddressingBoth Addressing = "both"
+)
+
+// DefaultTarget is the name of the target which is described
+// by the CLI arguments and env. variables.
+const DefaultTarget = "default"
+
+// Config describes a S3 endpoint and the parameters
+// used by tests when talking to this endpoint.
+type Config struct {
+	// Endpoint is the S3 endpoint - e.g. 'localhost:9000'.
+	Endpoint string
+	// Region is the region of the endpoint - e.g. 'eu-west-1'.
+	// Tests create their buckets in this region and Stores sign
+	// requests for it - except the minio-go client which detects
+	// the region of each bucket itself. If not set DefaultRegion
+	// is used.
+	Region string
+	// Addressing is the bucket addressing style of requests
+	// to the endpoint. If not set AddressingPath is used.
+	// Virtual-host-style requests to subdomains of 'localhost'
+	// are sent to the endpoint. See: Transport
+	Addressing Addressing
+	// Signature is the signature scheme of requests to the endpoint.
+	// If set, clients and Stores send requests through a transport
+	// which replaces the signature computed by the client library.
+	// If not set each client library chooses the signature scheme.
+	Signature Signature
+	// AccessKey is the S3 access-key for the endpoint.
+	AccessKey string
+	// SecretKey is the S3 secret-key for the endpoint.
+	SecretKey string
+	// SessionToken is the optional session token of
+	// temporary S3 credentials.
+	SessionToken string
+	// Provider is an optional CredentialsProvider - e.g. an STS
+	// AssumeRole provider. If set, the credentials are retrieved
+	// from the Provider instead of using the AccessKey, SecretKey
+	// and SessionToken.
+	Provider CredentialsProvider
+	// Insecure allows TLS to endpoints without a valid signed TLS certificate.
+	// Particually useful for local servers.
+	Insecure bool
+	// NoTLS disables TLS. All client requests will be made of plain HTTP/TCP connections.
+	// Tests which require TLS will be skipped.
+	NoTLS bool
+	// CACert is the path of a PEM-encoded CA certificate bundle used to
+	// verify the server certificate instead of the system root CAs.
+	CACert string
+	// RootCAs is an optional pool of CA certificates used to verify the
+	// server certificate instead of the system root CAs. Only one of
+	// CACert and RootCAs must be set.
+	RootCAs *x509.CertPool
+	// ClientCert is the path of a PEM-encoded client certificate used
+	// to authenticate to the endpoint. It requires a ClientKey.
+	ClientCert string
+	// ClientKey is the path of the PEM-encoded private key of the
+	// ClientCert.
+	ClientKey string
+	// WrapTransport is an optional hook which wraps the HTTP transport
+	// of clients created by NewClient - e.g. to trace or modify requests.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+	// Size is the size of objects for single-part operations in bytes.
+	// If not set DefaultSize is used.
+	Size int64
+	// MultipartSize is the size of objects for multi-part operations in bytes.
+	// If not set DefaultMultipartSize is used.
+	MultipartSize int64
+	// Sizes are the object sizes in bytes the put, get, copy and
+	// range tests run with - e.g. boundaries like 5MiB and 5MiB+1.
+	// If not set the tests use Size or MultipartSize. See: RunSizes
+	Sizes []int64
+	// KMSKeyID is the ID of the KMS master key SSE-KMS tests
+	// request - e.g. an AWS KMS key ARN or the name of a KES
+	// key. If not set the server uses its default master key.
+	KMSKeyID string
+	// Features contains the optional S3 features which are
+	// explicitly enabled or disabled for the endpoint.
+	Features Features
+}
+
+// Validate returns an error if the config does not specify
+// an endpoint or neither a credentials provider nor an
+// access-key and a secret-key. It also returns an error if
+// a size, the addressing style or the signature scheme are
+// invalid.
+func (c *Config) Validate() error {
+	if c.Endpoint == "" {
+		return errors.New("No server endpoint is provided")
+	}
+	if c.Provider == nil {
+		if c.AccessKey == "" {
+			return errors.New("No access key is provided")
+		}
+		if c.SecretKey == "" {
+			return errors.New("No secret key is provided")
+		}
+	}
+	if c.Size < 0 || c.MultipartSize < 0 {
+		return errors.New("The object size must not be negative")
+	}
+	for _, size := range c.Sizes {
+		if size < 0 {
+			return errors.New("The object size must not be negative")
+		}
+	}
+	switch c.Addressing {
+	case "", AddressingPath, AddressingVirtualHost, AddressingBoth:
+	default:
+		return errors.New("Unknown addressing style '" + string(c.Addressing) + "'")
+	}
+	switch c.Signature {
+	case "", SignatureV2, SignatureV4, SignatureV4UnsignedPayload, SignatureV4Streaming, SignatureAll:
+	default:
+		return errors.New("Unknown signature scheme '" + string(c.Signature) + "'")
+	}
+	return nil
+}
+
+// Secure returns true if clients should use TLS
+// when talking to the endpoint.
+func (c *Config) Secure() bool { return !c.NoTLS }
+
+// region returns the region of the endpoint or
+// DefaultRegion if no region is specified.
+func (c *Config) region() string {
+	if c.Region == "" {
+		return DefaultRegion
+	}
+	return c.Region
+}
+
+// Credentials returns the S3 credentials of the endpoint.
+// If the config has a credentials provider the credentials
+// are retrieved from the provider.
+func (c *Config) Credentials() (Credentials, error) {
+	if c.Provider != nil {
+		creds, _, err := c.Provider.Retrieve()
+		return creds, err
+	}
+	return Credentials{
+		AccessKey:    c.AccessKey,
+		SecretKey:    c.SecretKey,
+		SessionToken: c.SessionToken,
+	}, nil
+}
+
+// MinioCredentials returns the S3 credentials of the endpoint,
+// including the session token, as minio-go credentials.
+// If the config has a credentials provider the minio-go credentials
+// are retrieved from the provider on every request.
+func (c *Config) MinioCredentials() *credentials.Credentials {
+	if c.Provider != nil {
+		return credentials.New(minioProvider{c.Provider})
+	}
+	return credentials.NewStaticV4(c.AccessKey, c.SecretKey, c.SessionToken)
+}
+
+// minioProvider adapts a CredentialsProvider to the
+// minio-go credentials.Provider interface.
+type minioProvider struct{ CredentialsProvider }
+
+func (p minioProvider) Retrieve() (credentials.Value, error) {
+	creds, _, err := p.CredentialsProvider.Retrieve()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// IsExpired always returns true such that minio-go asks the
+// CredentialsProvider - which handles caching and refreshing
+// itself - for the credentials before every request.
+func (minioProvider) IsExpired() bool { return true }
+
+// setDefaults sets all unspecified optional values
+// to their defaults.
+func (c *Config) setDefaults() {
+	if c.Size == 0 {
+		c.Size = DefaultSize
+	}
+	if c.MultipartSize == 0 {
+		c.MultipartSize = DefaultMultipartSize
+	}
+}
+
+// Targets is a set of named S3 endpoint configurations.
+// It allows running the same tests against multiple
+// S3 servers within one test binary.
+type Targets map[string]Config
+
+// Validate returns an error if the targets are empty
+// or if any target config is not valid.
+func (targets Targets) Validate() error {
+	if len(targets) == 0 {
+		return errors.New("No S3 target is specified")
+	}
+	for _, name := range targets.Names() {
+		config := targets[name]
+		if err := config.Validate(); err != nil {
+			return errors.New("Target '" + name + "': " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Names returns the sorted names of all targets.
+func (targets Targets) Names() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs f as subtest of t for every target. The name of
+// each subtest is the name of the target. Targets with
+// AddressingBoth run twice - as '<name>-path' and as
+// '<name>-virtual-host' - such that differences between
+// both addressing styles show up as separate failures.
+// Similarly, targets with SignatureAll run once per signature
+// scheme - e.g. as '<name>-v2'. If t fails, Run logs the Seed.
+func (targets Targets) Run(t *testing.T, f func(*testing.T, Config)) {
+	reportSeed(t)
+	names, configs := targets.configs()
+	for i, name := range names {
+		config := configs[i]
+		t.Run(name, func(t *testing.T) { f(t, config) })
+	}
+}
+
+// RunBenchmark runs f as sub-benchmark of b for every target.
+// The name of each sub-benchmark is the name of the target.
+// Targets with AddressingBoth or SignatureAll run multiple
+// times. See: Run
+func (targets Targets) RunBenchmark(b *testing.B, f func(*testing.B, Config)) {
+	reportSeed(b)
+	names, configs := targets.configs()
+	for i, name := range names {
+		config := configs[i]
+		b.Run(name, func(b *testing.B) { f(b, config) })
+	}
+}
+
+// configs returns the names and configs of all targets sorted
+// by name. It expands each target with AddressingBoth and/or
+// SignatureAll into one config per addressing style and
+// signature scheme.
+func (targets Targets) configs() ([]string, []Config) {
+	var (
+		names   []string
+		configs []Config
+	)
+	for _, name := range targets.Names() {
+		config := targets[name]
+		config.setDefaults()
+
+		addressings := []Addressing{config.Addressing}
+		if config.Addressing == AddressingBoth {
+			addressings = []Addressing{AddressingPath, AddressingVirtualHost}
+		}
+		signatures := []Signature{config.Signature}
+		if config.Signature == SignatureAll {
+			signatures = Signatures
+		}
+		for _, addressing := range addressings {
+			for _, signature := range signatures {
+				config.Addressing, config.Signature = addressing, signature
+
+				variant := name
+				if len(addressings) > 1 {
+					variant += "-" + string(addressing)
+				}
+				if len(signatures) > 1 {
+					variant += "-" + string(signature)
+				}
+				names, configs = append(names, variant), append(configs, config)
+			}
+		}
+	}
+	return names, configs
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RegisterFlags registers the CLI flags describing the S3 targets -
+// e.g. '-server', '-access', '-secret' and '-size' - on fs. The name
+// of each flag is prefixed with prefix - e.g. the prefix 's3.' turns
+// '-server' into '-s3.server'.
+//
+// Parse returns the targets described by the flags registered by
+// the last RegisterFlags call. The package itself does not register
+// any flags. Import the github.com/aead/s3/flags package to register
+// them on flag.CommandLine.
+func RegisterFlags(fs *flag.FlagSet, prefix string) {
+	values := new(flagValues)
+	values.register(fs, prefix)
+
+	registeredLock.Lock()
+	registered, registeredSet = values, fs
+	registeredLock.Unlock()
+}
+
+// ParseArgs parses the command line arguments - without the
+// program name - and returns the S3 targets specified by them.
+// It accepts the same flags as RegisterFlags - without a prefix -
+// and falls back to the same env. variables as Parse.
+//
+// In contrast to Parse, ParseArgs neither uses nor modifies the
+// flags registered by RegisterFlags.
+func ParseArgs(args []string) (Targets, error) {
+	fs := flag.NewFlagSet("s3", flag.ContinueOnError)
+	values := new(flagValues)
+	values.register(fs, "")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return values.targets()
+}
+
+var (
+	registeredLock sync.Mutex
+	registered     *flagValues   // The flag values of the last RegisterFlags call.
+	registeredSet  *flag.FlagSet // The FlagSet of the last RegisterFlags call.
+)
+
+// flagValues holds the values of the CLI flags
+// registered on one FlagSet.
+type flagValues struct {
+	configPath string    // The path of the config file specified by the '-config' CLI flag.
+	profile    string    // The AWS profile specified by the '-profile' CLI flag.
+	seed       int64     // The seed specified by the '-seed' CLI flag.
+	sts        stsConfig // The STS config populated by the CLI flags.
+	config     Config    // The config of the DefaultTarget populated by the CLI flags.
+}
+
+func (v *flagValues) register(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&v.configPath, prefix+"config", "", "The path of a JSON or YAML config file describing the S3 targets.")
+
+	fs.StringVar(&v.config.Endpoint, prefix+"server", "localhost:9000", "The S3 server endpoint.")
+	fs.StringVar(&v.config.Region, prefix+"region", "", "The S3 region. Default: "+DefaultRegion)
+	fs.Var((*addressingValue)(&v.config.Addressing), prefix+"addressing", "The bucket addressing style: 'path', 'virtual-host' or 'both'. Default: path")
+	fs.Var((*signatureValue)(&v.config.Signature), prefix+"signature", "The signature scheme: 'v2', 'v4', 'v4-unsigned-payload', 'v4-streaming' or 'all'. Default: chosen by the client library")
+	fs.StringVar(&v.config.AccessKey, prefix+"access", "", "The S3 access key ID.")
+	fs.StringVar(&v.config.SecretKey, prefix+"secret", "", "The S3 secret key.")
+	fs.StringVar(&v.config.SessionToken, prefix+"token", "", "The S3 session token of temporary credentials.")
+	fs.StringVar(&v.profile, prefix+"profile", "", "The AWS profile used if no access and secret key is provided.")
+
+	fs.StringVar(&v.sts.Endpoint, prefix+"sts", "", "The STS endpoint URL. Default: The S3 server endpoint.")
+	fs.StringVar(&v.sts.RoleARN, prefix+"role", "", "The ARN of the role assumed to obtain temporary credentials.")
+	fs.StringVar(&v.sts.WebIdentityTokenFile, prefix+"webIdentityToken", "", "The path of a web identity token file used to obtain temporary credentials.")
+
+	fs.BoolVar(&v.config.Insecure, prefix+"insecure", false, "Skip TLS certificate checks.")
+	fs.BoolVar(&v.config.NoTLS, prefix+"noTLS", false, "Disable TLS. If set -"+prefix+"insecure does nothing.")
+	fs.StringVar(&v.config.CACert, prefix+"cacert", "", "The path of a PEM-encoded CA certificate bundle used to verify the server certificate.")
+	fs.StringVar(&v.config.ClientCert, prefix+"cert", "", "The path of a PEM-encoded client certificate used for mutual TLS.")
+	fs.StringVar(&v.config.ClientKey, prefix+"key", "", "The path of the PEM-encoded private key of the client certificate.")
+
+	fs.Var(newSizeValue(DefaultSize, &v.config.Size), prefix+"size", "The object size for single part operations - e.g. '32KB' or '1.5MiB'. All units (KB, MB, GB, TB and KiB, MiB, GiB, TiB) are powers of 1024. Default: 32KB")
+	fs.Var(newSizeValue(DefaultMultipartSize, &v.config.MultipartSize), prefix+"sizeMultipart", "The object size for multipart part operations. See: -size. Default: 65MB")
+	fs.Var((*sizesValue)(&v.config.Sizes), prefix+"sizes", "A comma-separated list of object sizes the put, get, copy and range tests run with - e.g. '0,1,64KiB-1,64KiB,64KiB+1,5MiB,1.5GB'. Default: -size and -sizeMultipart")
+	fs.StringVar(&v.config.KMSKeyID, prefix+"kms-key", "", "The ID of the KMS master key used by SSE-KMS tests. Default: the server's default key")
+
+	fs.Int64Var(&v.seed, prefix+"seed", 0, "The seed of generated bucket names, object names and object data. Default: random")
+}
+
+// targets returns the S3 targets described by the flag values
+// and the env. variables. See Parse for a description.
+func (v *flagValues) targets() (Targets, error) {
+	configPath := v.configPath
+	if configPath == "" {
+		configPath = os.Getenv("S3_TEST_CONFIG")
+	}
+	if configPath != "" {
+		return LoadConfig(configPath)
+	}
+
+	config, sts := v.config, v.sts
+	var ok bool
+	if config.Endpoint == "" {
+		config.Endpoint, ok = os.LookupEnv("SERVER_ENDPOINT")
+		if !ok {
+			return nil, errors.New("No server endpoint is provided and also no SERVER_ENDPOINT env. variable is exported")
+		}
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	if config.AccessKey == "" {
+		config.AccessKey = os.Getenv("ACCESS_KEY")
+	}
+	if config.SecretKey == "" {
+		config.SecretKey = os.Getenv("SECRET_KEY")
+	}
+	if config.SessionToken == "" {
+		config.SessionToken = os.Getenv("SESSION_TOKEN")
+	}
+	if config.AccessKey == "" && config.SecretKey == "" {
+		creds, err := awsCredentials(v.profile)
+		if err != nil && v.profile != "" {
+			return nil, err
+		}
+		config.AccessKey, config.SecretKey = creds.AccessKey, creds.SecretKey
+		if config.SessionToken == "" {
+			config.SessionToken = creds.SessionToken
+		}
+	}
+	if sts.RoleARN == "" {
+		sts.RoleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+	if sts.WebIdentityTokenFile == "" {
+		sts.WebIdentityTokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if sts.RoleSessionName == "" {
+		sts.RoleSessionName = os.Getenv("AWS_ROLE_SESSION_NAME")
+	}
+	if sts.WebIdentityTokenFile == "" {
+		// Only web identity tokens can be used without
+		// an access key and a secret key.
+		if config.AccessKey == "" {
+			return nil, errors.New("No access key is provided and also no ACCESS_KEY env. variable is exported and no AWS credentials are found")
+		}
+		if config.SecretKey == "" {
+			return nil, errors.New("No secret key is provided and also no SECRET_KEY env. variable is exported and no AWS credentials are found")
+		}
+	}
+	if sts.enabled() {
+		provider, err := sts.provider(&config)
+		if err != nil {
+			return nil, err
+		}
+		config.Provider = provider
+	}
+	config.setDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return Targets{DefaultTarget: config}, nil
+}
+
+type addressingValue Addressing
+
+func (av *addressingValue) Set(s string) error {
+	switch addressing := Addressing(s); addressing {
+	case AddressingPath, AddressingVirtualHost, AddressingBoth:
+		*av = addressingValue(addressing)
+		return nil
+	default:
+		return errors.New("Unknown addressing style '" + s + "'")
+	}
+}
+
+func (av *addressingValue) Get() interface{} { return Addressing(*av) }
+
+func (av *addressingValue) String() string { return string(*av) }
+
+type signatureValue Signature
+
+func (sv *signatureValue) Set(s string) error {
+	switch signature := Signature(s); signature {
+	case SignatureV2, SignatureV4, SignatureV4UnsignedPayload, SignatureV4Streaming, SignatureAll:
+		*sv = signatureValue(signature)
+		return nil
+	default:
+		return errors.New("Unknown signature scheme '" + s + "'")
+	}
+}
+
+func (sv *signatureValue) Get() interface{} { return Signature(*sv) }
+
+func (sv *signatureValue) String() string { return string(*sv) }
+
+type sizeValue int64
+
+func newSizeValue(val int64, p *int64) *sizeValue {
+	*p = val
+	return (*sizeValue)(p)
+}
+
+// Set parses the size like ParseSize - e.g. '32KiB' or '1.5GB'.
+// For compatibility with existing -size and -sizeMultipart values,
+// the units KB, MB, GB and TB are powers of 1024 and a negative
+// size is treated as its absolute value.
+func (sv *sizeValue) Set(s string) error {
+	v, err := parseSize(strings.TrimPrefix(strings.TrimSpace(s), "-"), binarySizeUnits)
+	if err != nil {
+		return err
+	}
+	*sv = sizeValue(v)
+	return nil
+}
+
+func (sv *sizeValue) Get() interface{} { return int64(*sv) }
+
+func (sv *sizeValue) String() string { return strconv.FormatInt(int64(*sv), 10) }
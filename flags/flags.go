@@ -0,0 +1,22 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+// Package flags registers the S3 CLI flags - e.g. '-server',
+// '-access' and '-secret' - on flag.CommandLine when imported:
+//
+//	import _ "github.com/aead/s3/flags"
+//
+// It keeps the behavior of previous versions of the s3 package,
+// which registered the flags on flag.CommandLine by itself.
+// Packages that want to control the flag names or the FlagSet
+// should call s3.RegisterFlags instead.
+package flags
+
+import (
+	"flag"
+
+	"github.com/aead/s3"
+)
+
+func init() { s3.RegisterFlags(flag.CommandLine, "") }
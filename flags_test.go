@@ -0,0 +1,192 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"flag"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aead/s3"
+	_ "github.com/aead/s3/flags" // Register the S3 flags on flag.CommandLine
+)
+
+var parseArgsTests = []struct {
+	Args   []string
+	Config s3.Config
+	Err    bool
+}{
+	{ // 0
+		Args:   []string{"-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize},
+	},
+	{ // 1
+		Args:   []string{"-server", "play.min.io", "-access", "access", "-secret", "secret", "-token", "token", "-noTLS"},
+		Config: s3.Config{Endpoint: "play.min.io", AccessKey: "access", SecretKey: "secret", SessionToken: "token", NoTLS: true, Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize},
+	},
+	{ // 2
+		Args:   []string{"-access", "access", "-secret", "secret", "-size", "1MB", "-sizeMultipart", "10MiB"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: 1 << 20, MultipartSize: 10 << 20},
+	},
+	{ // 3
+		Args:   []string{"-region", "eu-west-1", "-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", Region: "eu-west-1", AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize},
+	},
+	{ // 4
+		Args: []string{"-access", "access"},
+		Err:  true,
+	},
+	{ // 5
+		Args: []string{"-access", "access", "-secret", "secret", "-size", "1XB"},
+		Err:  true,
+	},
+	{ // 6
+		Args: []string{"-unknown"},
+		Err:  true,
+	},
+	{ // 7
+		Args:   []string{"-addressing", "both", "-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", Addressing: s3.AddressingBoth, AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize},
+	},
+	{ // 8
+		Args: []string{"-addressing", "dns", "-access", "access", "-secret", "secret"},
+		Err:  true,
+	},
+	{ // 9
+		Args:   []string{"-signature", "v4-streaming", "-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", Signature: s3.SignatureV4Streaming, AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize},
+	},
+	{ // 10
+		Args: []string{"-signature", "v3", "-access", "access", "-secret", "secret"},
+		Err:  true,
+	},
+	{ // 11
+		Args:   []string{"-sizes", "0,1,64KiB-1,1.5kB", "-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize, Sizes: []int64{0, 1, 64*1024 - 1, 1500}},
+	},
+	{ // 12
+		Args: []string{"-sizes", "0,1,-1", "-access", "access", "-secret", "secret"},
+		Err:  true,
+	},
+	{ // 13
+		Args:   []string{"-kms-key", "my-key", "-access", "access", "-secret", "secret"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: s3.DefaultSize, MultipartSize: s3.DefaultMultipartSize, KMSKeyID: "my-key"},
+	},
+	{ // 14
+		Args:   []string{"-access", "access", "-secret", "secret", "-size", "32KB", "-sizeMultipart", "65MB"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: 32 << 10, MultipartSize: 65 << 20},
+	},
+	{ // 15
+		Args:   []string{"-access", "access", "-secret", "secret", "-size", "-1024", "-sizeMultipart", "5MB+1"},
+		Config: s3.Config{Endpoint: "localhost:9000", AccessKey: "access", SecretKey: "secret", Size: 1024, MultipartSize: 5<<20 + 1},
+	},
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, env := range []string{"S3_TEST_CONFIG", "SERVER_ENDPOINT", "AWS_REGION", "ACCESS_KEY", "SECRET_KEY", "SESSION_TOKEN", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		t.Setenv(env, "")
+	}
+	for i, test := range parseArgsTests {
+		targets, err := s3.ParseArgs(test.Args)
+		if err != nil && !test.Err {
+			t.Fatalf("Test %d: Failed to parse args: %v", i, err)
+		}
+		if err == nil && test.Err {
+			t.Fatalf("Test %d: Parsing should have failed but it succeeded", i)
+		}
+		if err != nil {
+			continue
+		}
+
+		config, ok := targets[s3.DefaultTarget]
+		if !ok {
+			t.Fatalf("Test %d: No default target", i)
+		}
+		if config.Endpoint != test.Config.Endpoint {
+			t.Fatalf("Test %d: Endpoint mismatch: got '%s' - want '%s'", i, config.Endpoint, test.Config.Endpoint)
+		}
+		if config.Addressing != test.Config.Addressing {
+			t.Fatalf("Test %d: Addressing mismatch: got '%s' - want '%s'", i, config.Addressing, test.Config.Addressing)
+		}
+		if config.Signature != test.Config.Signature {
+			t.Fatalf("Test %d: Signature mismatch: got '%s' - want '%s'", i, config.Signature, test.Config.Signature)
+		}
+		if config.Region != test.Config.Region {
+			t.Fatalf("Test %d: Region mismatch: got '%s' - want '%s'", i, config.Region, test.Config.Region)
+		}
+		if config.AccessKey != test.Config.AccessKey || config.SecretKey != test.Config.SecretKey || config.SessionToken != test.Config.SessionToken {
+			t.Fatalf("Test %d: Credentials mismatch", i)
+		}
+		if config.NoTLS != test.Config.NoTLS {
+			t.Fatalf("Test %d: NoTLS mismatch: got %v - want %v", i, config.NoTLS, test.Config.NoTLS)
+		}
+		if config.Size != test.Config.Size || config.MultipartSize != test.Config.MultipartSize {
+			t.Fatalf("Test %d: Size mismatch: got %d/%d - want %d/%d", i, config.Size, config.MultipartSize, test.Config.Size, test.Config.MultipartSize)
+		}
+		if !reflect.DeepEqual(config.Sizes, test.Config.Sizes) {
+			t.Fatalf("Test %d: Sizes mismatch: got %v - want %v", i, config.Sizes, test.Config.Sizes)
+		}
+		if config.KMSKeyID != test.Config.KMSKeyID {
+			t.Fatalf("Test %d: KMS key mismatch: got '%s' - want '%s'", i, config.KMSKeyID, test.Config.KMSKeyID)
+		}
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	if flag.Lookup("server") == nil {
+		t.Fatal("The '-server' flag is not registered on flag.CommandLine")
+	}
+
+	// Parse caches the targets of the flags registered on
+	// flag.CommandLine. Registering the flags again below does
+	// not affect the other tests.
+	s3.Parse()
+
+	// Parsing a prefixed FlagSet must not change the flags
+	// registered on flag.CommandLine.
+	server := flag.Lookup("server").Value.String()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	s3.RegisterFlags(fs, "s3.")
+	for _, name := range []string{"s3.server", "s3.access", "s3.secret", "s3.size", "s3.config"} {
+		if fs.Lookup(name) == nil {
+			t.Fatalf("The '-%s' flag is not registered", name)
+		}
+	}
+	if fs.Lookup("server") != nil {
+		t.Fatal("The '-server' flag is registered without the prefix")
+	}
+	if err := fs.Parse([]string{"-s3.server", "example.com"}); err != nil {
+		t.Fatalf("Failed to parse prefixed flags: %v", err)
+	}
+	if value := flag.Lookup("server").Value.String(); value != server {
+		t.Fatalf("The '-server' flag has been modified: got '%s' - want '%s'", value, server)
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	const N = 8
+	var (
+		wg      sync.WaitGroup
+		errs    [N]error
+		targets [N]s3.Targets
+	)
+	for i := 0; i < N; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			targets[i], errs[i] = s3.Parse()
+		}(i)
+	}
+	wg.Wait()
+	for i := 1; i < N; i++ {
+		if errs[i] != errs[0] {
+			t.Fatalf("Test %d: Parse returned a different error: got '%v' - want '%v'", i, errs[i], errs[0])
+		}
+		if len(targets[i]) != len(targets[0]) {
+			t.Fatalf("Test %d: Parse returned different targets", i)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KMSVersion is the version reported by the KMS.
+const KMSVersion = "v0.0.0-s3test"
+
+// KMS is a minimal KMS implementing the subset of the KES
+// HTTP API which S3 servers use for SSE-KMS - e.g. minio
+// configured with MINIO_KMS_KES_ENDPOINT. It allows running
+// the SSE-KMS tests against a local server without a real
+// KMS. See: cmd/s3kms
+//
+// The KMS does not persist any state. It derives each master
+// key from its secret and the key name and seals data keys
+// with AES-256-GCM using the encryption context as associated
+// data. A KMS with the same secret can decrypt all data keys
+// generated by another one. The KMS does not authenticate
+// clients and must only be used for tests.
+type KMS struct {
+	secret []byte
+
+	lock sync.RWMutex
+	keys map[string]bool
+}
+
+// NewKMS returns a new KMS which derives its master keys
+// from the secret. The KMS contains the given master keys.
+// Clients can create further keys through the KES API.
+func NewKMS(secret []byte, keys ...string) *KMS {
+	kms := &KMS{
+		secret: append([]byte{}, secret...),
+		keys:   make(map[string]bool, len(keys)),
+	}
+	for _, key := range keys {
+		kms.keys[key] = true
+	}
+	return kms
+}
+
+// Keys returns the names of all master keys of the KMS.
+func (k *KMS) Keys() []string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	keys := make([]string, 0, len(k.keys))
+	for key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	errKMSKeyExists   = kmsError{status: http.StatusBadRequest, message: "key already exists"}
+	errKMSKeyNotFound = kmsError{status: http.StatusNotFound, message: "key does not exist"}
+	errKMSDecrypt     = kmsError{status: http.StatusBadRequest, message: "decryption failed: ciphertext is not authentic"}
+)
+
+// kmsRequest is the JSON body of a KES encrypt,
+// decrypt and generate request. The []byte values
+// are base64-encoded.
+type kmsRequest struct {
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+	Context    []byte `json:"context,omitempty"`
+}
+
+// kmsResponse is the JSON body of a KES encrypt,
+// decrypt and generate response.
+type kmsResponse struct {
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// ServeHTTP handles the KES API requests:
+//
+//	GET    /version
+//	GET    /v1/status
+//	POST   /v1/key/create/<name>
+//	GET    /v1/key/describe/<name>
+//	DELETE /v1/key/delete/<name>
+//	POST   /v1/key/generate/<name>
+//	POST   /v1/key/encrypt/<name>
+//	POST   /v1/key/decrypt/<name>
+//	POST   /v1/key/bulk/decrypt/<name>
+func (k *KMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/version" && r.Method == http.MethodGet:
+		writeKMSResponse(w, struct {
+			Version string `json:"version"`
+		}{Version: KMSVersion})
+	case path == "/v1/status" && r.Method == http.MethodGet:
+		writeKMSResponse(w, struct {
+			Version string `json:"version"`
+			Keys    int    `json:"keys"`
+		}{Version: KMSVersion, Keys: len(k.Keys())})
+	case strings.HasPrefix(path, "/v1/key/create/") && r.Method == http.MethodPost:
+		if err := k.create(strings.TrimPrefix(path, "/v1/key/create/")); err != nil {
+			writeKMSError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(path, "/v1/key/describe/") && r.Method == http.MethodGet:
+		name := strings.TrimPrefix(path, "/v1/key/describe/")
+		if _, err := k.masterKey(name); err != nil {
+			writeKMSError(w, err)
+			return
+		}
+		writeKMSResponse(w, struct {
+			Name      string `json:"name"`
+			Algorithm string `json:"algorithm"`
+		}{Name: name, Algorithm: "AES256-GCM_SHA256"})
+	case strings.HasPrefix(path, "/v1/key/delete/") && r.Method == http.MethodDelete:
+		k.delete(strings.TrimPrefix(path, "/v1/key/delete/"))
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(path, "/v1/key/generate/") && r.Method == http.MethodPost:
+		k.handle(w, r, strings.TrimPrefix(path, "/v1/key/generate/"), k.generate)
+	case strings.HasPrefix(path, "/v1/key/encrypt/") && r.Method == http.MethodPost:
+		k.handle(w, r, strings.TrimPrefix(path, "/v1/key/encrypt/"), k.encrypt)
+	case strings.HasPrefix(path, "/v1/key/decrypt/") && r.Method == http.MethodPost:
+		k.handle(w, r, strings.TrimPrefix(path, "/v1/key/decrypt/"), k.decrypt)
+	case strings.HasPrefix(path, "/v1/key/bulk/decrypt/") && r.Method == http.MethodPost:
+		k.bulkDecrypt(w, r, strings.TrimPrefix(path, "/v1/key/bulk/decrypt/"))
+	default:
+		writeKMSError(w, kmsError{status: http.StatusNotFound, message: "not found"})
+	}
+}
+
+// handle decodes a single KES request, applies f using the
+// master key name and writes the response.
+func (k *KMS) handle(w http.ResponseWriter, r *http.Request, name string, f func(key []byte, req kmsRequest) (kmsResponse, error)) {
+	key, err := k.masterKey(name)
+	if err != nil {
+		writeKMSError(w, err)
+		return
+	}
+	var req kmsRequest
+	if err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeKMSError(w, kmsError{status: http.StatusBadRequest, message: "invalid request body: " + err.Error()})
+		return
+	}
+	resp, err := f(key, req)
+	if err != nil {
+		writeKMSError(w, err)
+		return
+	}
+	writeKMSResponse(w, resp)
+}
+
+func (k *KMS) bulkDecrypt(w http.ResponseWriter, r *http.Request, name string) {
+	key, err := k.masterKey(name)
+	if err != nil {
+		writeKMSError(w, err)
+		return
+	}
+	var reqs []kmsRequest
+	if err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&reqs); err != nil {
+		writeKMSError(w, kmsError{status: http.StatusBadRequest, message: "invalid request body: " + err.Error()})
+		return
+	}
+	resps := make([]kmsResponse, 0, len(reqs))
+	for _, req := range reqs {
+		resp, err := k.decrypt(key, req)
+		if err != nil {
+			writeKMSError(w, err)
+			return
+		}
+		resps = append(resps, resp)
+	}
+	writeKMSResponse(w, resps)
+}
+
+func (k *KMS) create(name string) error {
+	if name == "" {
+		return kmsError{status: http.StatusBadRequest, message: "invalid key name"}
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.keys[name] {
+		return errKMSKeyExists
+	}
+	k.keys[name] = true
+	return nil
+}
+
+func (k *KMS) delete(name string) {
+	k.lock.Lock()
+	delete(k.keys, name)
+	k.lock.Unlock()
+}
+
+// masterKey returns the 256 bit master key name.
+func (k *KMS) masterKey(name string) ([]byte, error) {
+	k.lock.RLock()
+	ok := k.keys[name]
+	k.lock.RUnlock()
+	if !ok {
+		return nil, errKMSKeyNotFound
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(name))
+	return mac.Sum(nil), nil
+}
+
+// generate returns a new 256 bit data key as plaintext
+// and encrypted with the master key.
+func (k *KMS) generate(key []byte, req kmsRequest) (kmsResponse, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return kmsResponse{}, err
+	}
+	resp, err := k.encrypt(key, kmsRequest{Plaintext: dataKey, Context: req.Context})
+	if err != nil {
+		return kmsResponse{}, err
+	}
+	resp.Plaintext = dataKey
+	return resp, nil
+}
+
+// encrypt seals the plaintext with the master key. The
+// ciphertext is the random nonce followed by the sealed
+// plaintext.
+func (k *KMS) encrypt(key []byte, req kmsRequest) (kmsResponse, error) {
+	aead, err := newKMSAEAD(key)
+	if err != nil {
+		return kmsResponse{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return kmsResponse{}, err
+	}
+	return kmsResponse{Ciphertext: aead.Seal(nonce, nonce, req.Plaintext, req.Context)}, nil
+}
+
+// decrypt opens a ciphertext produced by encrypt. It fails
+// if the context does not match the encryption context.
+func (k *KMS) decrypt(key []byte, req kmsRequest) (kmsResponse, error) {
+	aead, err := newKMSAEAD(key)
+	if err != nil {
+		return kmsResponse{}, err
+	}
+	if len(req.Ciphertext) < aead.NonceSize() {
+		return kmsResponse{}, errKMSDecrypt
+	}
+	nonce, ciphertext := req.Ciphertext[:aead.NonceSize()], req.Ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, req.Context)
+	if err != nil {
+		return kmsResponse{}, errKMSDecrypt
+	}
+	return kmsResponse{Plaintext: plaintext}, nil
+}
+
+func newKMSAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// kmsError is a KES API error with a HTTP status code.
+type kmsError struct {
+	status  int
+	message string
+}
+
+func (e kmsError) Error() string { return e.message }
+
+// writeKMSError writes err as KES API error response.
+func writeKMSError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if e, ok := err.(kmsError); ok {
+		status = e.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{Message: err.Error()})
+}
+
+func writeKMSResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
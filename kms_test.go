@@ -0,0 +1,132 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+// kmsRequest sends a KES API request with the JSON-encoded
+// body to the server and decodes the JSON response into v.
+func kmsRequest(server *httptest.Server, method, path string, body, v interface{}) (int, error) {
+	var content bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&content).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, &content)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		err = json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode, err
+}
+
+type kmsKey struct {
+	Plaintext  []byte `json:"plaintext,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+	Context    []byte `json:"context,omitempty"`
+}
+
+var kmsTests = []struct {
+	Key, DecryptKey         string
+	Context, DecryptContext []byte
+	Status, DecryptStatus   int
+}{
+	{Key: "my-key", DecryptKey: "my-key", Status: http.StatusOK, DecryptStatus: http.StatusOK},                                                                            // 0
+	{Key: "my-key", DecryptKey: "my-key", Context: []byte(`{"a":"b"}`), DecryptContext: []byte(`{"a":"b"}`), Status: http.StatusOK, DecryptStatus: http.StatusOK},         // 1
+	{Key: "my-key", DecryptKey: "my-key", Context: []byte(`{"a":"b"}`), DecryptContext: []byte(`{"a":"c"}`), Status: http.StatusOK, DecryptStatus: http.StatusBadRequest}, // 2 Wrong context
+	{Key: "my-key", DecryptKey: "other-key", Status: http.StatusOK, DecryptStatus: http.StatusBadRequest},                                                                 // 3 Wrong key
+	{Key: "unknown-key", Status: http.StatusNotFound},                                                                                                                     // 4
+}
+
+func TestKMS(t *testing.T) {
+	server := httptest.NewServer(s3.NewKMS([]byte("my-secret"), "my-key", "other-key"))
+	defer server.Close()
+
+	for i, test := range kmsTests {
+		var key kmsKey
+		status, err := kmsRequest(server, http.MethodPost, "/v1/key/generate/"+test.Key, kmsKey{Context: test.Context}, &key)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to generate data key: %v", i, err)
+		}
+		if status != test.Status {
+			t.Fatalf("Test %d: Status mismatch: got %d - want %d", i, status, test.Status)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if len(key.Plaintext) != 32 || len(key.Ciphertext) == 0 {
+			t.Fatalf("Test %d: Invalid data key: plaintext=%d bytes ciphertext=%d bytes", i, len(key.Plaintext), len(key.Ciphertext))
+		}
+
+		var plaintext kmsKey
+		status, err = kmsRequest(server, http.MethodPost, "/v1/key/decrypt/"+test.DecryptKey, kmsKey{Ciphertext: key.Ciphertext, Context: test.DecryptContext}, &plaintext)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to decrypt data key: %v", i, err)
+		}
+		if status != test.DecryptStatus {
+			t.Fatalf("Test %d: Decrypt status mismatch: got %d - want %d", i, status, test.DecryptStatus)
+		}
+		if status == http.StatusOK && !bytes.Equal(plaintext.Plaintext, key.Plaintext) {
+			t.Fatalf("Test %d: Decrypted data key does not match generated data key", i)
+		}
+	}
+}
+
+func TestKMSKeys(t *testing.T) {
+	kms := s3.NewKMS([]byte("my-secret"), "my-key")
+	server := httptest.NewServer(kms)
+	defer server.Close()
+
+	if status, err := kmsRequest(server, http.MethodGet, "/version", nil, nil); err != nil || status != http.StatusOK {
+		t.Fatalf("Failed to fetch KMS version: status=%d err=%v", status, err)
+	}
+	if status, _ := kmsRequest(server, http.MethodPost, "/v1/key/create/my-key", nil, nil); status != http.StatusBadRequest {
+		t.Fatalf("Creating an existing key should fail with %d but got %d", http.StatusBadRequest, status)
+	}
+	if status, _ := kmsRequest(server, http.MethodPost, "/v1/key/create/new-key", nil, nil); status != http.StatusOK {
+		t.Fatalf("Failed to create key: status=%d", status)
+	}
+	if keys := kms.Keys(); len(keys) != 2 || keys[0] != "my-key" || keys[1] != "new-key" {
+		t.Fatalf("Keys mismatch: got %v - want [my-key new-key]", keys)
+	}
+
+	var key kmsKey
+	if status, _ := kmsRequest(server, http.MethodPost, "/v1/key/generate/new-key", kmsKey{}, &key); status != http.StatusOK {
+		t.Fatalf("Failed to generate data key: status=%d", status)
+	}
+	if status, _ := kmsRequest(server, http.MethodDelete, "/v1/key/delete/new-key", nil, nil); status != http.StatusOK {
+		t.Fatalf("Failed to delete key: status=%d", status)
+	}
+	if status, _ := kmsRequest(server, http.MethodPost, "/v1/key/decrypt/new-key", kmsKey{Ciphertext: key.Ciphertext}, nil); status != http.StatusNotFound {
+		t.Fatalf("Decrypting with a deleted key should fail with %d but got %d", http.StatusNotFound, status)
+	}
+
+	// A KMS with the same secret derives the same master keys.
+	other := httptest.NewServer(s3.NewKMS([]byte("my-secret"), "new-key"))
+	defer other.Close()
+	var plaintext kmsKey
+	if status, _ := kmsRequest(other, http.MethodPost, "/v1/key/decrypt/new-key", kmsKey{Ciphertext: key.Ciphertext}, &plaintext); status != http.StatusOK {
+		t.Fatalf("Failed to decrypt data key: status=%d", status)
+	}
+	if !bytes.Equal(plaintext.Plaintext, key.Plaintext) {
+		t.Fatal("Decrypted data key does not match generated data key")
+	}
+}
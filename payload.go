@@ -0,0 +1,120 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// Payload is deterministic pseudorandom object data of a
+// fixed size. It generates any byte range on demand such
+// that tests can upload and verify objects of any size -
+// e.g. multiple GB - without keeping them in memory.
+//
+// The content of a Payload is the AES-CTR key stream of
+// a key derived from a pseudorandom number generator.
+// Therefore, two Payloads derived from generators with
+// the same seed have the same content.
+type Payload struct {
+	size  int64
+	block cipher.Block
+}
+
+// NewPayload returns a new Payload of the given size
+// derived from r - e.g. s3.NewPayload(s3.Rand(t), size).
+func NewPayload(r *rand.Rand, size int64) Payload {
+	var key [16]byte
+	r.Read(key[:])
+	block, _ := aes.NewCipher(key[:])
+	return Payload{size: size, block: block}
+}
+
+// Size returns the size of the Payload in bytes.
+func (p Payload) Size() int64 { return p.size }
+
+// Reader returns a new io.ReadSeeker which
+// reads the Payload from the beginning.
+func (p Payload) Reader() io.ReadSeeker { return io.NewSectionReader(p, 0, p.size) }
+
+// ReadAt reads len(b) bytes of the Payload starting at
+// offset off. It implements io.ReaderAt.
+func (p Payload) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("Invalid payload offset: negative offset")
+	}
+	if off >= p.size {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remaining := p.size - off; int64(len(b)) > remaining {
+		b, err = b[:remaining], io.EOF
+	}
+	for i := range b {
+		b[i] = 0
+	}
+
+	var iv [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(iv[8:], uint64(off/aes.BlockSize))
+	stream := cipher.NewCTR(p.block, iv[:])
+
+	var skip [aes.BlockSize]byte
+	stream.XORKeyStream(skip[:off%aes.BlockSize], skip[:off%aes.BlockSize])
+	stream.XORKeyStream(b, b)
+	return len(b), err
+}
+
+// Verify reads r until EOF and returns an error if the content
+// of r does not match the Payload.
+func (p Payload) Verify(r io.Reader) error { return p.VerifyRange(r, 0, p.size) }
+
+// VerifyRange reads r until EOF and returns an error if the content
+// of r does not match the length bytes of the Payload starting
+// at offset - e.g. the response body of a range request.
+func (p Payload) VerifyRange(r io.Reader, offset, length int64) error {
+	if offset < 0 || length < 0 || offset+length > p.size {
+		return fmt.Errorf("Invalid payload range: offset=%d length=%d size=%d", offset, length, p.size)
+	}
+
+	var (
+		got  = make([]byte, 32*1024)
+		want = make([]byte, len(got))
+		pos  int64
+	)
+	for {
+		n, err := r.Read(got)
+		if pos+int64(n) > length {
+			return fmt.Errorf("Content mismatch: content is longer than %d bytes", length)
+		}
+		if n > 0 {
+			p.ReadAt(want[:n], offset+pos)
+			if !bytes.Equal(got[:n], want[:n]) {
+				i := 0
+				for got[i] == want[i] {
+					i++
+				}
+				return fmt.Errorf("Content mismatch at offset %d", offset+pos+int64(i))
+			}
+			pos += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if pos != length {
+		return fmt.Errorf("Content mismatch: got %d bytes - want %d bytes", pos, length)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var payloadRangeTests = []struct {
+	Offset, Length int64
+}{
+	{Offset: 0, Length: 0},            // 0
+	{Offset: 0, Length: 1},            // 1
+	{Offset: 15, Length: 2},           // 2
+	{Offset: 16, Length: 16},          // 3
+	{Offset: 1000, Length: 70 * 1024}, // 4
+	{Offset: 99999, Length: 8},        // 5
+}
+
+func TestPayload(t *testing.T) {
+	const size = 100*1024 + 7
+	payload := s3.NewPayload(rand.New(rand.NewSource(1)), size)
+
+	data, err := ioutil.ReadAll(payload.Reader())
+	if err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	if len(data) != size || payload.Size() != size {
+		t.Fatalf("Payload size mismatch: got %d - want %d", len(data), size)
+	}
+	if bytes.Equal(data[:64], make([]byte, 64)) {
+		t.Fatal("Payload starts with all-zero data")
+	}
+	if other, _ := ioutil.ReadAll(s3.NewPayload(rand.New(rand.NewSource(1)), size).Reader()); !bytes.Equal(data, other) {
+		t.Fatal("Payloads with the same seed have different content")
+	}
+	if err = payload.Verify(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Failed to verify payload: %v", err)
+	}
+
+	for i, test := range payloadRangeTests {
+		reader := payload.Reader()
+		if _, err = reader.Seek(test.Offset, io.SeekStart); err != nil {
+			t.Fatalf("Test %d: Failed to seek: %v", i, err)
+		}
+		buffer := make([]byte, test.Length)
+		if _, err = io.ReadFull(reader, buffer); err != nil {
+			t.Fatalf("Test %d: Failed to read payload: %v", i, err)
+		}
+		if !bytes.Equal(buffer, data[test.Offset:test.Offset+test.Length]) {
+			t.Fatalf("Test %d: Payload range does not match payload", i)
+		}
+		if err = payload.VerifyRange(bytes.NewReader(buffer), test.Offset, test.Length); err != nil {
+			t.Fatalf("Test %d: Failed to verify payload range: %v", i, err)
+		}
+	}
+
+	modified := append([]byte(nil), data...)
+	modified[size/2] ^= 1
+	if err = payload.Verify(bytes.NewReader(modified)); err == nil {
+		t.Fatal("Verifying modified content should fail but succeeded")
+	}
+	if err = payload.Verify(bytes.NewReader(data[:size-1])); err == nil {
+		t.Fatal("Verifying truncated content should fail but succeeded")
+	}
+	if err = payload.VerifyRange(bytes.NewReader(data[:11]), 0, 10); err == nil {
+		t.Fatal("Verifying too long content should fail but succeeded")
+	}
+}
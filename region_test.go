@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+// bucketRegion returns the region in which the tests
+// create their buckets for the given config.
+func bucketRegion(config s3.Config) string {
+	if config.Region == "" {
+		return s3.DefaultRegion
+	}
+	return config.Region
+}
+
+// otherRegion returns a region which differs from
+// the region of the given config.
+func otherRegion(config s3.Config) string {
+	if bucketRegion(config) == "eu-west-1" {
+		return "us-west-2"
+	}
+	return "eu-west-1"
+}
+
+func TestBucketLocation(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.RunStores(t, testBucketLocation)
+}
+
+func testBucketLocation(t *testing.T, config s3.Config, store s3.Store) {
+	bucket := s3.BucketName("test-bucket-location")
+	config.MakeTestBucket(t, store, bucket)
+
+	location, err := store.GetBucketLocation(bucket)
+	if err != nil {
+		t.Fatalf("Failed to get location of bucket '%s': %v", bucket, err)
+	}
+	if region := bucketRegion(config); location != region {
+		t.Fatalf("Bucket '%s' is located in '%s' but should be located in '%s'", bucket, location, region)
+	}
+}
+
+// The region tests send plain HTTP requests since client
+// libraries - like minio-go - may detect the region of a
+// bucket and resend requests for the right region.
+
+func TestIllegalLocationConstraint(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testIllegalLocationConstraint)
+}
+
+func testIllegalLocationConstraint(t *testing.T, config s3.Config) {
+	if !config.Features.Enabled(s3.FeatureRegion) {
+		t.Skipf("Skipping test because feature '%s' is disabled", s3.FeatureRegion)
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket, location := s3.BucketName("test-illegal-location"), otherRegion(config)
+	err := store.MakeBucket(bucket, location)
+	if err == nil {
+		s3.RemoveBucket(bucket, store.RemoveBucket, t)
+		t.Fatalf("Creating bucket at '%s' in region '%s' should fail but succeeded", location, bucketRegion(config))
+	}
+	s3.ErrIllegalLocationConstraint.Expect(t, err)
+}
+
+func TestWrongRegion(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testWrongRegion)
+}
+
+func testWrongRegion(t *testing.T, config s3.Config) {
+	if !config.Features.Enabled(s3.FeatureRegion) {
+		t.Skipf("Skipping test because feature '%s' is disabled", s3.FeatureRegion)
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket := s3.BucketName("test-wrong-region")
+	config.MakeTestBucket(t, store, bucket)
+
+	wrongConfig := config
+	wrongConfig.Region = otherRegion(config)
+	_, err := wrongConfig.NewStore(t, s3.StoreHTTP).ListObjects(bucket, "")
+	if err == nil {
+		t.Fatalf("Request for region '%s' should fail but succeeded", wrongConfig.Region)
+	}
+	errResp, ok := s3.AsResponseError(err)
+	if !ok {
+		t.Fatalf("Request for region '%s' failed with a non-S3 error: %v", wrongConfig.Region, err)
+	}
+	if errResp.Code != s3.ErrPermanentRedirect.Code && errResp.Code != s3.ErrAuthorizationHeaderMalformed.Code {
+		t.Fatalf("Request for region '%s' should fail with 'PermanentRedirect' or 'AuthorizationHeaderMalformed' but failed with: %v", wrongConfig.Region, err)
+	}
+	if region := bucketRegion(config); errResp.Region != "" && errResp.Region != region {
+		t.Fatalf("The error response points to region '%s' but the bucket is located in '%s'", errResp.Region, region)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+)
+
+// ForceRemoveBucket removes the bucket and everything within it.
+// It aborts all incomplete multipart uploads and removes all
+// objects - including all versions and delete markers. Legal holds
+// are lifted and governance-mode retention is bypassed where allowed.
+// It returns nil if the bucket does not exist.
+//
+// ForceRemoveBucket sends plain HTTP requests and can be passed to
+// MakeBucket and RemoveBucket such that buckets are removed even if
+// a test fails before removing its objects.
+func (c *Config) ForceRemoveBucket(bucket string) error {
+	client, err := c.rawClient()
+	if err != nil {
+		return err
+	}
+	defer client.CloseIdleConnections()
+
+	switch err := c.abortUploads(client, bucket); {
+	case isAPIError(err, ErrNoSuchBucket):
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := c.removeObjects(client, bucket); err != nil {
+		return err
+	}
+	resp, err := c.send(client, Request{Method: http.MethodDelete, Bucket: bucket})
+	if isAPIError(err, ErrNoSuchBucket) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// abortUploads aborts all incomplete multipart uploads
+// within the bucket. It does nothing if the server does
+// not implement listing multipart uploads.
+func (c *Config) abortUploads(client *http.Client, bucket string) error {
+	var keyMarker, uploadIDMarker string
+	for {
+		query := url.Values{"uploads": {""}}
+		if keyMarker != "" {
+			query.Set("key-marker", keyMarker)
+			query.Set("upload-id-marker", uploadIDMarker)
+		}
+		resp, err := c.send(client, Request{Method: http.MethodGet, Bucket: bucket, Query: query})
+		if isAPIError(err, ErrNotImplemented) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			IsTruncated        bool   `xml:"IsTruncated"`
+			NextKeyMarker      string `xml:"NextKeyMarker"`
+			NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+			Uploads            []struct {
+				Key      string `xml:"Key"`
+				UploadID string `xml:"UploadId"`
+			} `xml:"Upload"`
+		}
+		err = decodeXML(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, upload := range result.Uploads {
+			resp, err := c.send(client, Request{Method: http.MethodDelete, Bucket: bucket, Object: upload.Key, Query: url.Values{"uploadId": {upload.UploadID}}})
+			if isAPIError(err, ErrNoSuchUpload) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+		if !result.IsTruncated || result.NextKeyMarker == "" {
+			return nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// removeObjects removes all object versions and delete markers
+// within the bucket. If the server does not implement listing
+// object versions, it removes all objects.
+func (c *Config) removeObjects(client *http.Client, bucket string) error {
+	var keyMarker, versionIDMarker string
+	for {
+		query := url.Values{"versions": {""}}
+		if keyMarker != "" {
+			query.Set("key-marker", keyMarker)
+			query.Set("version-id-marker", versionIDMarker)
+		}
+		resp, err := c.send(client, Request{Method: http.MethodGet, Bucket: bucket, Query: query})
+		if isAPIError(err, ErrNotImplemented) {
+			return c.removeUnversionedObjects(client, bucket)
+		}
+		if err != nil {
+			return err
+		}
+
+		type version struct {
+			Key       string `xml:"Key"`
+			VersionID string `xml:"VersionId"`
+		}
+		var result struct {
+			IsTruncated         bool      `xml:"IsTruncated"`
+			NextKeyMarker       string    `xml:"NextKeyMarker"`
+			NextVersionIDMarker string    `xml:"NextVersionIdMarker"`
+			Versions            []version `xml:"Version"`
+			DeleteMarkers       []version `xml:"DeleteMarker"`
+		}
+		err = decodeXML(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, v := range append(result.Versions, result.DeleteMarkers...) {
+			if err = c.removeObjectVersion(client, bucket, v.Key, v.VersionID); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextKeyMarker == "" {
+			return nil
+		}
+		keyMarker, versionIDMarker = result.NextKeyMarker, result.NextVersionIDMarker
+	}
+}
+
+// removeUnversionedObjects removes all objects within the bucket
+// using the ListObjectsV2 API.
+func (c *Config) removeUnversionedObjects(client *http.Client, bucket string) error {
+	for {
+		resp, err := c.send(client, Request{Method: http.MethodGet, Bucket: bucket, Query: url.Values{"list-type": {"2"}}})
+		if err != nil {
+			return err
+		}
+		var result struct {
+			IsTruncated bool `xml:"IsTruncated"`
+			Contents    []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		err = decodeXML(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, content := range result.Contents {
+			if err = c.removeObjectVersion(client, bucket, content.Key, ""); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || len(result.Contents) == 0 {
+			return nil
+		}
+	}
+}
+
+// removeObjectVersion removes the object version. If the version
+// cannot be removed, it tries to lift the legal hold of the version
+// and to bypass its governance-mode retention.
+func (c *Config) removeObjectVersion(client *http.Client, bucket, object, versionID string) error {
+	var query url.Values
+	if versionID != "" {
+		query = url.Values{"versionId": {versionID}}
+	}
+	resp, err := c.send(client, Request{Method: http.MethodDelete, Bucket: bucket, Object: object, Query: query})
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if isAPIError(err, ErrNoSuchKey) {
+		return nil
+	}
+
+	legalHold, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"LegalHold"`
+		Status  string   `xml:"Status"`
+	}{Status: "OFF"})
+	sum := md5.Sum(legalHold)
+	holdQuery := url.Values{"legal-hold": {""}}
+	if versionID != "" {
+		holdQuery.Set("versionId", versionID)
+	}
+	if resp, err := c.send(client, Request{
+		Method: http.MethodPut,
+		Bucket: bucket,
+		Object: object,
+		Query:  holdQuery,
+		Header: http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}},
+		Body:   legalHold,
+	}); err == nil {
+		resp.Body.Close()
+	}
+
+	resp, err = c.send(client, Request{
+		Method: http.MethodDelete,
+		Bucket: bucket,
+		Object: object,
+		Query:  query,
+		Header: http.Header{"X-Amz-Bypass-Governance-Retention": {"true"}},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// isAPIError returns true if err is a S3 error
+// response with the error code of apiErr.
+func isAPIError(err error, apiErr APIError) bool {
+	code, ok := ErrorCode(err)
+	return ok && code == apiErr.Code
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+func TestForceRemoveBucket(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	bucket := s3.BucketName("test-force-remove")
+	if err := store.MakeBucket(bucket, region); err != nil {
+		t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+	}
+	data := []byte("Hello World")
+	for _, object := range []string{"object-1", "object-2", "dir/object-3"} {
+		if _, err := store.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to create object '%s/%s': %v", bucket, object, err)
+		}
+	}
+	if _, err := store.NewMultipartUpload(bucket, "object-4", s3.PutOptions{}); err != nil {
+		t.Fatalf("Failed to start multipart upload: %v", err)
+	}
+
+	// Overwrite and remove objects of the versioned bucket
+	// to create noncurrent object versions and delete markers.
+	resp, err := config.Do(s3.Request{
+		Method: http.MethodPut,
+		Bucket: bucket,
+		Query:  url.Values{"versioning": {""}},
+		Body:   []byte(`<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to enable versioning of bucket '%s': %v", bucket, err)
+	}
+	resp.Body.Close()
+	if _, err := store.PutObject(bucket, "object-1", bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+		t.Fatalf("Failed to overwrite object '%s/%s': %v", bucket, "object-1", err)
+	}
+	for _, object := range []string{"object-2", "dir/object-3"} {
+		if err := store.RemoveObject(bucket, object); err != nil {
+			t.Fatalf("Failed to remove object '%s/%s': %v", bucket, object, err)
+		}
+	}
+	if versions, deleteMarkers := listVersions(t, config, bucket); versions != 5 || deleteMarkers != 2 {
+		t.Fatalf("Bucket '%s' contains %d versions and %d delete markers but expected %d and %d", bucket, versions, deleteMarkers, 5, 2)
+	}
+	s3.ErrBucketNotEmpty.Expect(t, store.RemoveBucket(bucket))
+
+	if err := config.ForceRemoveBucket(bucket); err != nil {
+		t.Fatalf("Failed to remove bucket '%s': %v", bucket, err)
+	}
+	if ok, err := store.BucketExists(bucket); err != nil || ok {
+		t.Fatalf("Bucket '%s' still exists - err: %v", bucket, err)
+	}
+	if err := config.ForceRemoveBucket(bucket); err != nil {
+		t.Fatalf("Removing a non-existing bucket should succeed but failed: %v", err)
+	}
+}
+
+// listVersions returns the number of object versions
+// and delete markers within the bucket.
+func listVersions(t *testing.T, config s3.Config, bucket string) (versions, deleteMarkers int) {
+	t.Helper()
+	resp, err := config.Do(s3.Request{Method: http.MethodGet, Bucket: bucket, Query: url.Values{"versions": {""}}})
+	if err != nil {
+		t.Fatalf("Failed to list object versions of bucket '%s': %v", bucket, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Versions      []struct{} `xml:"Version"`
+		DeleteMarkers []struct{} `xml:"DeleteMarker"`
+	}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode object versions of bucket '%s': %v", bucket, err)
+	}
+	return len(result.Versions), len(result.DeleteMarkers)
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request is a raw S3 request. In contrast to S3 client libraries,
+// NewRequest neither validates nor completes a Request. Therefore,
+// it can describe malformed requests - e.g. with invalid headers,
+// a wrong Content-Length, duplicate SSE headers or a broken XML
+// body - to test how a S3 server handles them.
+type Request struct {
+	// Method is the HTTP method - e.g. 'PUT'.
+	Method string
+	// Bucket is the bucket of the request. If empty, the
+	// request is sent to the service - e.g. to list buckets.
+	Bucket string
+	// Object is the object name of the request.
+	Object string
+	// Query contains the URL query parameters.
+	Query url.Values
+	// Header contains the HTTP headers. They are sent as they
+	// are - e.g. use Header.Add to send a header twice.
+	//
+	// The 'Host' and 'Content-Length' header replace the
+	// host and the length of the body. The entire Body is
+	// sent even if the Content-Length does not match its
+	// size - e.g. to test how a server handles a body which
+	// is shorter or longer than the Content-Length.
+	Header http.Header
+	// Body is the request body.
+	Body []byte
+
+	// PayloadHash is the signed hash of the Body. If empty,
+	// the hex-encoded SHA-256 hash of the Body is used. It is
+	// sent as 'X-Amz-Content-Sha256' header unless the Header
+	// contains one.
+	PayloadHash string
+	// Anonymous sends the request without signing it.
+	Anonymous bool
+}
+
+// NewRequest returns a HTTP request for the endpoint of the config
+// described by r. The request is signed with AWS signature V4 using
+// the credentials, the region and the addressing style of the config.
+//
+// If the Content-Length of r does not match the size of its Body,
+// the request can only be sent by Do or DoRaw. The net/http client
+// rejects such requests.
+//
+// The response to the request can be decoded with DecodeResponse.
+func (c *Config) NewRequest(r Request) (*http.Request, error) {
+	endpoint := objectURL(c.url(), c.Addressing == AddressingVirtualHost, r.Bucket, r.Object)
+	req, err := http.NewRequest(r.Method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = r.Query.Encode()
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	req = req.WithContext(context.WithValue(req.Context(), requestKey{}, r))
+
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+	contentLength := int64(len(r.Body))
+	if length := req.Header.Get("Content-Length"); length != "" {
+		n, err := strconv.ParseInt(length, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New("Invalid Content-Length '" + length + "'")
+		}
+		contentLength = n
+		req.Header.Del("Content-Length")
+	}
+	if len(r.Body) > 0 || contentLength > 0 {
+		req.Body, req.ContentLength = ioutil.NopCloser(bytes.NewReader(r.Body)), contentLength
+	}
+	if r.Anonymous {
+		return req, nil
+	}
+
+	creds, err := c.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := r.PayloadHash
+	if payloadHash == "" {
+		payloadHash = sha256Hex(r.Body)
+	}
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	signV4(req, creds, c.region(), "s3", payloadHash, time.Now())
+	return req, nil
+}
+
+// Do sends the request described by r to the endpoint of the config
+// and returns the response. The request is sent through the transport
+// hook of the config - but not re-signed with the signature scheme
+// of the config - and redirects are not followed. Requests with a
+// Content-Length which does not match the size of the body are sent
+// over a new connection - bypassing the transport hook - which is
+// half-closed after the body has been written. See: Request
+//
+// Do returns an *ErrorResponse if the server does not respond with
+// a 2xx status code. See: DecodeResponse
+func (c *Config) Do(r Request) (*http.Response, error) {
+	client, err := c.rawClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+	return c.send(client, r)
+}
+
+// DoRaw sends the request described by r like Do but returns the
+// response together with its entire body - regardless of the status
+// code. The body of the returned response is replaced by an in-memory
+// copy, such that it can be read again. DoRaw is meant for tests which
+// inspect error responses, e.g. whether they reveal object data.
+//
+// The returned error is the S3 error of the response, if any. It only
+// returns a nil response if the request could not be sent.
+// See: DecodeResponse
+func (c *Config) DoRaw(r Request) (*http.Response, []byte, error) {
+	client, err := c.rawClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := c.NewRequest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	err = DecodeResponse(resp)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, body, err
+}
+
+// rawClient returns a HTTP client for sending Requests which
+// does not follow redirects.
+func (c *Config) rawClient() (*http.Client, error) {
+	transport, err := c.wrappedTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &contentLengthTransport{RoundTripper: transport, config: c},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+// contentLengthTransport is a http.RoundTripper which sends
+// requests created by NewRequest over a new connection if their
+// Content-Length does not match the size of the body. All other
+// requests are sent by the RoundTripper.
+//
+// The net/http client refuses to send a body which does not
+// match the Content-Length. Therefore, contentLengthTransport
+// writes the request itself and half-closes the connection
+// afterwards such that the server sees the end of a body which
+// is shorter than the Content-Length instead of waiting for it.
+type contentLengthTransport struct {
+	http.RoundTripper
+	config *Config
+}
+
+func (t *contentLengthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, ok := req.Context().Value(requestKey{}).(Request)
+	if !ok || req.ContentLength == int64(len(r.Body)) {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	address := req.URL.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		if req.URL.Scheme == "https" {
+			address = net.JoinHostPort(address, "443")
+		} else {
+			address = net.JoinHostPort(address, "80")
+		}
+	}
+	dial := t.config.dialContext(&net.Dialer{Timeout: 30 * time.Second})
+	conn, err := dial(req.Context(), "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme == "https" {
+		tlsConfig, err := t.config.TLSConfig()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = req.URL.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.HandshakeContext(req.Context()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	var buf bytes.Buffer
+	buf.WriteString(req.Method + " " + req.URL.RequestURI() + " HTTP/1.1\r\n")
+	buf.WriteString("Host: " + host + "\r\n")
+	req.Header.Write(&buf)
+	buf.WriteString("Content-Length: " + strconv.FormatInt(req.ContentLength, 10) + "\r\n")
+	buf.WriteString("Connection: close\r\n\r\n")
+	buf.Write(r.Body)
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err = c.CloseWrite(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body = connBody{ReadCloser: resp.Body, conn: conn}
+	return resp, nil
+}
+
+// connBody is a response body which closes
+// the connection when the body is closed.
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b connBody) Close() error {
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
+
+// send sends the request described by r using the client.
+// See: Do
+func (c *Config) send(client *http.Client, r Request) (*http.Response, error) {
+	req, err := c.NewRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = DecodeResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// DecodeResponse returns nil if the response has a 2xx status code.
+// Otherwise, it reads and closes the response body and returns the
+// S3 error of the response as *ErrorResponse. ErrorCode and
+// ErrorMessage return the S3 error code and message of the error.
+//
+// If the response does not contain a S3 error - e.g. responses to
+// HEAD requests - the error is derived from the status code.
+func DecodeResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	var bucket, object string
+	if resp.Request != nil {
+		if r, ok := resp.Request.Context().Value(requestKey{}).(Request); ok {
+			bucket, object = r.Bucket, r.Object
+		} else {
+			path := strings.TrimPrefix(resp.Request.URL.Path, "/")
+			if i := strings.IndexByte(path, '/'); i >= 0 {
+				bucket, object = path[:i], path[i+1:]
+			} else {
+				bucket = path
+			}
+		}
+	}
+	return decodeErrorResponse(resp, bucket, object)
+}
+
+// requestKey is the context key of the Request
+// a HTTP request has been created from.
+type requestKey struct{}
+
+// objectURL returns the URL of the object at the bucket
+// using virtual-host-style or path-style addressing.
+func objectURL(endpoint string, virtualHost bool, bucket, object string) string {
+	path := "/" + bucket
+	if virtualHost && bucket != "" {
+		scheme, host := splitScheme(endpoint)
+		endpoint, path = scheme+bucket+"."+host, ""
+	}
+	if object != "" {
+		path += "/" + object
+	}
+	if path == "" {
+		path = "/"
+	}
+	return endpoint + encodePath(path)
+}
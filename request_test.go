@@ -0,0 +1,229 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var requestTests = []struct {
+	Request s3.Request
+	Code    string // The expected S3 error code - if any.
+	Err     bool   // NewRequest should fail.
+}{
+	{ // 0
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket"},
+		Code:    "IllegalLocationConstraintException",
+	},
+	{ // 1
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket", Body: []byte("<CreateBucketConfiguration><LocationConstraint>eu-west-1</LocationConstraint></CreateBucketConfiguration>")},
+	},
+	{ // 2
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket", Object: "object", Body: []byte("Hello World")},
+	},
+	{ // 3
+		Request: s3.Request{Method: http.MethodGet, Bucket: "bucket", Object: "missing"},
+		Code:    "NoSuchKey",
+	},
+	{ // 4
+		Request: s3.Request{Method: http.MethodHead, Bucket: "bucket", Object: "missing"},
+		Code:    "NoSuchKey",
+	},
+	{ // 5
+		Request: s3.Request{Method: http.MethodHead, Bucket: "missing"},
+		Code:    "NoSuchBucket",
+	},
+	{ // 6
+		Request: s3.Request{Method: http.MethodGet, Bucket: "bucket", Object: "object", Anonymous: true},
+		Code:    "AccessDenied",
+	},
+	{ // 7
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket", Object: "object", Header: http.Header{"Content-Length": []string{"5"}}, Body: []byte("Hello World")},
+	},
+	{ // 8
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket", Object: "object", Header: http.Header{"Content-Length": []string{"12"}}, Body: []byte("Hello World")},
+		Code:    "IncompleteBody",
+	},
+	{ // 9
+		Request: s3.Request{Method: http.MethodPut, Bucket: "bucket", Object: "object", Header: http.Header{"Content-Length": []string{"-1"}}},
+		Err:     true,
+	},
+	{ // 10
+		Request: s3.Request{Method: http.MethodPost, Bucket: "bucket", Object: "object", Query: url.Values{"unknown": []string{""}}},
+		Code:    "NotImplemented",
+	},
+}
+
+func TestRequest(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	for i, test := range requestTests {
+		req, err := config.NewRequest(test.Request)
+		if err != nil && !test.Err {
+			t.Fatalf("Test %d: Failed to create request: %v", i, err)
+		}
+		if err == nil && test.Err {
+			t.Fatalf("Test %d: Creating request should have failed but it succeeded", i)
+		}
+		if err != nil {
+			continue
+		}
+		if signed := req.Header.Get("Authorization") != ""; signed == test.Request.Anonymous {
+			t.Fatalf("Test %d: Request signed: got %v - want %v", i, signed, !test.Request.Anonymous)
+		}
+
+		resp, err := config.Do(test.Request)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if code, _ := s3.ErrorCode(err); code != test.Code {
+			t.Fatalf("Test %d: Error code mismatch: got '%s' - want '%s' - err: %v", i, code, test.Code, err)
+		}
+	}
+
+	resp, err := config.Do(s3.Request{Method: http.MethodGet, Bucket: "bucket", Object: "object"})
+	if err != nil {
+		t.Fatalf("Failed to get object: %v", err)
+	}
+	defer resp.Body.Close()
+	if content, err := ioutil.ReadAll(resp.Body); err != nil || string(content) != "Hello" {
+		t.Fatalf("The Content-Length did not truncate the body: got '%s' - want '%s' - err: %v", content, "Hello", err)
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testMalformedRequest)
+}
+
+func testMalformedRequest(t *testing.T, config s3.Config) {
+	store := config.NewStore(t, s3.StoreHTTP)
+	bucket := s3.BucketName("test-malformed-request")
+	config.MakeTestBucket(t, store, bucket)
+
+	// S3 joins duplicate headers - e.g. 'AES256,AES256' - and
+	// must reject the result instead of using one of the values.
+	duplicateSSE := http.Header{}
+	duplicateSSE.Add("X-Amz-Server-Side-Encryption", "AES256")
+	duplicateSSE.Add("X-Amz-Server-Side-Encryption", "AES256")
+	duplicateSSEC := customerKeyHeader("AES256", customerKey, nil)
+	duplicateSSEC.Add("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+
+	requests := []struct {
+		Request s3.Request
+		Err     s3.APIError
+		Feature string // The request is skipped if the feature is disabled.
+	}{
+		{ // 0
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Object: "object", Body: []byte("Hello World"), PayloadHash: strings.Repeat("0", 64)},
+			Err:     s3.ErrXAmzContentSHA256Mismatch,
+		},
+		{ // 1
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Query: url.Values{"versioning": []string{""}}, Body: []byte("<VersioningConfiguration")},
+			Err:     s3.ErrMalformedXML,
+		},
+		{ // 2 Content-Length exceeds the body
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Object: "object", Header: http.Header{"Content-Length": []string{"12"}}, Body: []byte("Hello World")},
+			Err:     s3.ErrIncompleteBody,
+		},
+		{ // 3 Copy source without an object
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Object: "object", Header: http.Header{"X-Amz-Copy-Source": []string{bucket}}},
+			Err:     s3.ErrInvalidArgument,
+		},
+		{ // 4 Duplicate SSE-S3 header
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Object: "object", Header: duplicateSSE, Body: []byte("Hello World")},
+			Err:     s3.ErrInvalidArgument,
+			Feature: s3.FeatureSSES3,
+		},
+		{ // 5 Duplicate SSE-C algorithm header
+			Request: s3.Request{Method: http.MethodPut, Bucket: bucket, Object: "object", Header: duplicateSSEC, Body: []byte("Hello World")},
+			Err:     s3.ErrInvalidArgument,
+			Feature: s3.FeatureSSEC,
+		},
+	}
+	for i, test := range requests {
+		if test.Feature != "" && !config.Features.Enabled(test.Feature) {
+			t.Logf("Test %d: Skipping request because feature '%s' is disabled", i, test.Feature)
+			continue
+		}
+		if test.Feature == s3.FeatureSSEC && config.NoTLS {
+			t.Logf("Test %d: Skipping request because SSE-C requires TLS", i)
+			continue
+		}
+		resp, err := config.Do(test.Request)
+		if err == nil {
+			resp.Body.Close()
+			if test.Request.Object != "" {
+				s3.RemoveObject(bucket, test.Request.Object, store.RemoveObject, t)
+			}
+		}
+		test.Err.Expect(t, err)
+	}
+}
+
+func TestDoRaw(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	if resp, err := config.Do(s3.Request{Method: http.MethodPut, Bucket: "bucket", Body: []byte("<CreateBucketConfiguration><LocationConstraint>eu-west-1</LocationConstraint></CreateBucketConfiguration>")}); err != nil {
+		t.Fatalf("Failed to create bucket: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if resp, err := config.Do(s3.Request{Method: http.MethodPut, Bucket: "bucket", Object: "object", Body: []byte("Hello World")}); err != nil {
+		t.Fatalf("Failed to upload object: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	resp, body, err := config.DoRaw(s3.Request{Method: http.MethodGet, Bucket: "bucket", Object: "object"})
+	if err != nil {
+		t.Fatalf("Failed to get object: %v", err)
+	}
+	if content, err := ioutil.ReadAll(resp.Body); err != nil || string(content) != "Hello World" || string(body) != "Hello World" {
+		t.Fatalf("Body mismatch: got '%s' and '%s' - want '%s' - err: %v", body, content, "Hello World", err)
+	}
+
+	resp, body, err = config.DoRaw(s3.Request{Method: http.MethodGet, Bucket: "bucket", Object: "missing"})
+	if resp == nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if code, _ := s3.ErrorCode(err); code != "NoSuchKey" {
+		t.Fatalf("Error code mismatch: got '%s' - want '%s' - err: %v", code, "NoSuchKey", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Status code mismatch: got %d - want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if content, err := ioutil.ReadAll(resp.Body); err != nil || !strings.Contains(string(body), "<Code>NoSuchKey</Code>") || string(content) != string(body) {
+		t.Fatalf("The error response body has not been kept: got '%s' and '%s' - err: %v", body, content, err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/minio/minio-go"
+)
+
+// ResponseError is a S3 error response independent of the
+// client library which received it. Fields not provided by
+// the client library are empty.
+type ResponseError struct {
+	Code       string // The S3 error code - e.g. 'NoSuchKey'.
+	Message    string // The S3 error message.
+	Resource   string // The bucket or object the error refers to.
+	RequestID  string // The ID of the request - i.e. 'X-Amz-Request-Id'.
+	HostID     string // The ID of the S3 host - i.e. 'X-Amz-Id-2'.
+	BucketName string
+	Key        string
+	StatusCode int    // The HTTP status code of the response.
+	Region     string // The region of the bucket - if provided.
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return "S3 request failed: " + e.Code
+	}
+	return "S3 request failed: " + e.Code + ": " + e.Message
+}
+
+// AsResponseError returns the S3 error response contained in err.
+// It understands the errors returned by every Store implementation
+// and client library - even if wrapped: minio.ErrorResponse values
+// and pointers, *ErrorResponse and aws-sdk-go-v2 API errors.
+// It returns false if err does not contain a S3 error response.
+func AsResponseError(err error) (ResponseError, bool) {
+	var minioErr minio.ErrorResponse
+	if errors.As(err, &minioErr) {
+		return minioResponseError(&minioErr), true
+	}
+	var minioErrPtr *minio.ErrorResponse
+	if errors.As(err, &minioErrPtr) && minioErrPtr != nil {
+		return minioResponseError(minioErrPtr), true
+	}
+	var errResp *ErrorResponse
+	if errors.As(err, &errResp) && errResp != nil {
+		return ResponseError{
+			Code:       errResp.Code,
+			Message:    errResp.Message,
+			Resource:   errResp.Resource,
+			RequestID:  errResp.RequestID,
+			HostID:     errResp.HostID,
+			BucketName: errResp.BucketName,
+			Key:        errResp.Key,
+			StatusCode: errResp.StatusCode,
+			Region:     errResp.Region,
+		}, true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		respErr := ResponseError{
+			Code:    apiErr.ErrorCode(),
+			Message: apiErr.ErrorMessage(),
+		}
+		var statusErr interface{ HTTPStatusCode() int }
+		if errors.As(err, &statusErr) {
+			respErr.StatusCode = statusErr.HTTPStatusCode()
+		}
+		var requestErr interface{ ServiceRequestID() string }
+		if errors.As(err, &requestErr) {
+			respErr.RequestID = requestErr.ServiceRequestID()
+		}
+		var hostErr interface{ ServiceHostID() string }
+		if errors.As(err, &hostErr) {
+			respErr.HostID = hostErr.ServiceHostID()
+		}
+		return respErr, true
+	}
+	return ResponseError{}, false
+}
+
+func minioResponseError(err *minio.ErrorResponse) ResponseError {
+	return ResponseError{
+		Code:       err.Code,
+		Message:    err.Message,
+		RequestID:  err.RequestID,
+		HostID:     err.HostID,
+		BucketName: err.BucketName,
+		Key:        err.Key,
+		StatusCode: err.StatusCode,
+		Region:     err.Region,
+	}
+}
+
+// ErrorCode returns the S3 error code of err - e.g. 'NoSuchKey'.
+// It understands the same errors as AsResponseError and returns
+// a boolean flag indicating whether err is such an error.
+func ErrorCode(err error) (string, bool) {
+	respErr, ok := AsResponseError(err)
+	return respErr.Code, ok
+}
+
+// ErrorMessage returns the S3 error message of err.
+// It understands the same errors as AsResponseError and returns
+// a boolean flag indicating whether err is such an error.
+func ErrorMessage(err error) (string, bool) {
+	respErr, ok := AsResponseError(err)
+	return respErr.Message, ok
+}
+
+// ExpectError fails the test if err is not a S3 error response
+// with the given error code - e.g. 'NoSuchKey'. It returns the
+// S3 error response for further checks.
+func ExpectError(t testing.TB, err error, code string) ResponseError {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("Request should fail with '%s' but succeeded", code)
+	}
+	respErr, ok := AsResponseError(err)
+	if !ok {
+		t.Fatalf("Request should fail with '%s' but failed with a non-S3 error: %v", code, err)
+	}
+	if respErr.Code != code {
+		t.Fatalf("Request should fail with '%s' but failed with: %v", code, err)
+	}
+	return respErr
+}
+
+// ExpectStatus fails the test if err is not a S3 error response
+// with the given HTTP status code - e.g. http.StatusNotFound. It
+// returns the S3 error response for further checks.
+func ExpectStatus(t testing.TB, err error, status int) ResponseError {
+	t.Helper()
+	want := strconv.Itoa(status) + " " + http.StatusText(status)
+	if err == nil {
+		t.Fatalf("Request should fail with '%s' but succeeded", want)
+	}
+	respErr, ok := AsResponseError(err)
+	if !ok {
+		t.Fatalf("Request should fail with '%s' but failed with a non-S3 error: %v", want, err)
+	}
+	if respErr.StatusCode != status {
+		t.Fatalf("Request should fail with '%s' but failed with '%d %s': %v", want, respErr.StatusCode, http.StatusText(respErr.StatusCode), err)
+	}
+	return respErr
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aead/s3"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/minio/minio-go"
+)
+
+func awsResponseError(status int, requestID string, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      err,
+		},
+		RequestID: requestID,
+	}
+}
+
+var responseErrorTests = []struct {
+	Err           error
+	ResponseError s3.ResponseError
+	OK            bool
+}{
+	{ // 0
+		Err:           minio.ErrorResponse{Code: "NoSuchKey", Message: "The specified key does not exist.", BucketName: "bucket", Key: "object", RequestID: "request", HostID: "host", StatusCode: http.StatusNotFound},
+		ResponseError: s3.ResponseError{Code: "NoSuchKey", Message: "The specified key does not exist.", BucketName: "bucket", Key: "object", RequestID: "request", HostID: "host", StatusCode: http.StatusNotFound},
+		OK:            true,
+	},
+	{ // 1
+		Err:           &minio.ErrorResponse{Code: "NoSuchBucket", StatusCode: http.StatusNotFound},
+		ResponseError: s3.ResponseError{Code: "NoSuchBucket", StatusCode: http.StatusNotFound},
+		OK:            true,
+	},
+	{ // 2
+		Err:           fmt.Errorf("wrapped: %w", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}),
+		ResponseError: s3.ResponseError{Code: "AccessDenied", StatusCode: http.StatusForbidden},
+		OK:            true,
+	},
+	{ // 3
+		Err:           fmt.Errorf("wrapped: %w", &s3.ErrorResponse{Code: "InvalidRequest", Resource: "/bucket/object", RequestID: "request", StatusCode: http.StatusBadRequest, Region: "eu-west-1"}),
+		ResponseError: s3.ResponseError{Code: "InvalidRequest", Resource: "/bucket/object", RequestID: "request", StatusCode: http.StatusBadRequest, Region: "eu-west-1"},
+		OK:            true,
+	},
+	{ // 4
+		Err:           awsResponseError(http.StatusConflict, "request", &smithy.GenericAPIError{Code: "BucketNotEmpty", Message: "The bucket is not empty."}),
+		ResponseError: s3.ResponseError{Code: "BucketNotEmpty", Message: "The bucket is not empty.", RequestID: "request", StatusCode: http.StatusConflict},
+		OK:            true,
+	},
+	{ // 5
+		Err:           &smithy.GenericAPIError{Code: "NotFound"},
+		ResponseError: s3.ResponseError{Code: "NotFound"},
+		OK:            true,
+	},
+	{ // 6
+		Err: errors.New("connection refused"),
+	},
+	{ // 7
+		Err: nil,
+	},
+}
+
+func TestAsResponseError(t *testing.T) {
+	for i, test := range responseErrorTests {
+		respErr, ok := s3.AsResponseError(test.Err)
+		if ok != test.OK {
+			t.Fatalf("Test %d: got %v - want %v", i, ok, test.OK)
+		}
+		if respErr != test.ResponseError {
+			t.Fatalf("Test %d: Response error mismatch: got %+v - want %+v", i, respErr, test.ResponseError)
+		}
+		if code, _ := s3.ErrorCode(test.Err); code != test.ResponseError.Code {
+			t.Fatalf("Test %d: Error code mismatch: got '%s' - want '%s'", i, code, test.ResponseError.Code)
+		}
+		if message, _ := s3.ErrorMessage(test.Err); message != test.ResponseError.Message {
+			t.Fatalf("Test %d: Error message mismatch: got '%s' - want '%s'", i, message, test.ResponseError.Message)
+		}
+	}
+}
+
+func TestExpectError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound})
+	if respErr := s3.ExpectError(t, err, "NoSuchKey"); respErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Status code mismatch: got %d - want %d", respErr.StatusCode, http.StatusNotFound)
+	}
+	if respErr := s3.ExpectStatus(t, err, http.StatusNotFound); respErr.Code != "NoSuchKey" {
+		t.Fatalf("Error code mismatch: got '%s' - want '%s'", respErr.Code, "NoSuchKey")
+	}
+}
@@ -5,167 +5,104 @@
 package s3
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"errors"
 	"flag"
-	"os"
-	"strconv"
-	"strings"
+	"sync"
 	"testing"
-
-	"github.com/minio/minio-go"
 )
 
-type sizeValue int64
-
-func newSizeValue(val int64, p *int64) *sizeValue {
-	*p = val
-	return (*sizeValue)(p)
+// Parse parses the command line arguments and returns
+// the S3 targets specified by them. It uses the flags registered
+// by RegisterFlags and parses flag.CommandLine if the flags are
+// registered on it but it has not been parsed yet. If no flags
+// are registered, Parse only uses the flag defaults and the env.
+// variables described below.
+//
+// If a config file is specified - either through the '-config'
+// CLI argument or through the 'S3_TEST_CONFIG' env. variable -
+// Parse returns the targets loaded from the config file and
+// ignores all other arguments describing the DefaultTarget.
+//
+// Otherwise, the endpoint, access-key
+// and secret-key of the DefaultTarget are taken from the
+// '-server', '-access' and '-secret' CLI arguments or - if not
+// provided - from the 'SERVER_ENDPOINT', 'ACCESS_KEY' and
+// 'SECRET_KEY' env. variables. The optional session token of
+// temporary credentials is taken from the '-token' CLI argument
+// or the 'SESSION_TOKEN' env. variable and the optional region
+// from the '-region' CLI argument or the 'AWS_REGION' env. variable.
+// If neither an access-key nor a secret-key is provided Parse
+// falls back to the AWS credentials - either exported as env.
+// variables (see EnvCredentials) or stored for the AWS profile
+// specified by the '-profile' CLI argument in the AWS shared
+// credentials and config files (see SharedCredentials).
+//
+// If a role is specified - either through the '-role' CLI argument
+// or the 'AWS_ROLE_ARN' env. variable - the DefaultTarget obtains
+// temporary credentials from the STS endpoint specified by the '-sts'
+// CLI argument (by default the S3 server endpoint). If a web identity
+// token file is specified - either through the '-webIdentityToken' CLI
+// argument or the 'AWS_WEB_IDENTITY_TOKEN_FILE' env. variable - the
+// credentials are obtained using AssumeRoleWithWebIdentity. Otherwise,
+// they are obtained using AssumeRole.
+// It returns an error if no server, access-key or secret-key
+// is provided and also no env. variables for the missing arguments
+// are exported.
+//
+// The returned Targets must not be modified.
+// It is safe to call Parse() multiple times and
+// concurrently. All calls return the same result.
+func Parse() (Targets, error) {
+	parseOnce.Do(func() {
+		Seed() // Fix the seed before the registered flags may change.
+		parsedTargets, parseErr = parseFlags().targets()
+	})
+	return parsedTargets, parseErr
 }
 
-func (sv *sizeValue) Set(s string) error {
-	const (
-		B  = 1
-		KB = 1024 * B
-		MB = 1024 * KB
-		GB = 1024 * MB
-	)
-	var (
-		v   int64
-		err error
-	)
-	switch upper := strings.ToUpper(s); {
-	default:
-		v, err = strconv.ParseInt(s, 10, 64)
-		v *= B
-	case strings.HasSuffix(upper, "GB"):
-		v, err = strconv.ParseInt(s[:len(s)-2], 10, 64)
-		v *= GB
-	case strings.HasSuffix(upper, "MB"):
-		v, err = strconv.ParseInt(s[:len(s)-2], 10, 64)
-		v *= MB
-	case strings.HasSuffix(upper, "KB"):
-		v, err = strconv.ParseInt(s[:len(s)-2], 10, 64)
-		v *= KB
-	case strings.HasSuffix(upper, "B"):
-		v, err = strconv.ParseInt(s[:len(s)-1], 10, 64)
-		v *= B
-	}
-	if err != nil {
-		return err
+// parseFlags returns the values of the flags registered by
+// the last RegisterFlags call - or the flag defaults if no
+// flags are registered. It parses flag.CommandLine if the
+// flags are registered on it but it has not been parsed yet.
+func parseFlags() *flagValues {
+	registeredLock.Lock()
+	values, fs := registered, registeredSet
+	registeredLock.Unlock()
+
+	if values == nil {
+		values = new(flagValues)
+		values.register(flag.NewFlagSet("", flag.ContinueOnError), "")
 	}
-	if v < 0 {
-		v *= -1
+	if fs == flag.CommandLine && !flag.Parsed() {
+		flag.Parse()
 	}
-	*sv = sizeValue(v)
-	return err
+	return values
 }
 
-func (sv *sizeValue) Get() interface{} { return int64(*sv) }
-
-func (sv *sizeValue) String() string { return strconv.FormatInt(int64(*sv), 10) }
-
-func init() {
-	flag.StringVar(&Endpoint, "server", "localhost:9000", "The S3 server endpoint.")
-	flag.StringVar(&AccessKey, "access", "", "The S3 access key ID.")
-	flag.StringVar(&SecretKey, "secret", "", "The S3 secret key.")
-
-	flag.BoolVar(&Insecure, "insecure", false, "Skip TLS certificate checks.")
-	flag.BoolVar(&NoTLS, "noTLS", false, "Disable TLS. If set -insecure does nothing.")
-
-	flag.Var(newSizeValue(32*1024, &Size), "size", "The object size for single part operations. Default: 32KB")
-	flag.Var(newSizeValue(64*1024*1024, &MultipartSize), "sizeMultipart", "The object size for multipart part operations. Default: 65MB")
-}
-
-var (
-	// Endpoint is the S3 endpoint. Specified either through the '-server' CLI argument
-	// or through the 'SERVER_ENDPOINT' env. variable. The default is 'localhost:9000'
-	Endpoint string
-	// AccessKey is the S3 access-key for the specified endpoint. Specified either through
-	// the '-access' CLI argument or through the 'ACCESS_KEY' env. variable.
-	AccessKey string
-	// SecretKey is the S3 secret-key for the specified endpoint. Specified either through
-	// the '-secret' CLI argument or through the 'SECRET_KEY' env. variable.
-	SecretKey string
-	// Insecure allows TLS to endpoints without a valid signed TLS certificate.
-	// Particually useful for local servers. Can be set using the '-insecure' CLI flag.
-	Insecure bool
-	// NoTLS disables TLS. All client requests will be made of plain HTTP/TCP connections.
-	// Tests which require TLS will be skipped.
-	NoTLS bool
-	// Size is the size of objects for single-part operations in bytes. It is set by the '-size' CLI flag.
-	Size int64
-	// MultipartSize is the size of objects for multi-part operations in bytes. It is set by the '-sizeMultipart' CLI flag.
-	MultipartSize int64
-)
-
 var (
-	parsed   = false
-	parseErr error
+	parseOnce     sync.Once
+	parsedTargets Targets
+	parseErr      error
 )
 
-// Parse parses the command line arguments.
-// It returns an error if no server, access-key
-// or secret-key is provided and also no env.
-// variables for the missing arguments are exported.
-//
-// It is save to call Parse() multiple times.
-func Parse() error {
-	if !parsed {
-		parsed = true
-		flag.Parse()
-
-		var ok bool
-		if Endpoint == "" {
-			Endpoint, ok = os.LookupEnv("SERVER_ENDPOINT")
-			if !ok {
-				parseErr = errors.New("No server endpoint is provided and also no SERVER_ENDPOINT env. variable is exported")
-				return parseErr
-			}
-		}
-		if AccessKey == "" {
-			AccessKey, ok = os.LookupEnv("ACCESS_KEY")
-			if !ok {
-				parseErr = errors.New("No access key is provided and also no ACCESS_KEY env. variable is exported")
-				return parseErr
-			}
-		}
-		if SecretKey == "" {
-			SecretKey, ok = os.LookupEnv("SECRET_KEY")
-			if !ok {
-				parseErr = errors.New("No secret key is provided and also no SECRET_KEY env. variable is exported")
-				return parseErr
-			}
-		}
-		if Size == 0 {
-			Size = 32 * 1024
-		}
-		if MultipartSize == 0 {
-			MultipartSize = 65 * 1024 * 1024
-		}
-	}
-	return parseErr
-}
-
-// BucketName returns a bucket name with the given
-// prefix and a random hex suffix.
-func BucketName(prefix string) string {
-	var random [4]byte
-	rand.Read(random[:])
-	return prefix + "-" + hex.EncodeToString(random[:])
-}
-
 // MakeBucket checks whether the bucket exists, if not creates it
 // and returns a function which removes the bucket if it was created successfully.
+// The bucket is created at the default location of the server. See: MakeBucketAt
 //
 // It simplifies code that should cleanup created objects and buckets.
+// Passing Config.ForceRemoveBucket as remove function removes the bucket
+// even if a test fails before removing its objects.
 func MakeBucket(bucket string, exists func(string) (bool, error), make func(string, string) error, remove func(string) error) (func(testing.TB), error) {
+	return MakeBucketAt(bucket, "", exists, make, remove)
+}
+
+// MakeBucketAt behaves like MakeBucket but creates the bucket
+// at the given location - usually the Region of the Config.
+func MakeBucketAt(bucket, location string, exists func(string) (bool, error), make func(string, string) error, remove func(string) error) (func(testing.TB), error) {
 	switch ok, err := exists(bucket); {
 	case err != nil:
 		return nil, err
 	case !ok:
-		if err = make(bucket, ""); err != nil {
+		if err = make(bucket, location); err != nil {
 			return nil, err
 		}
 		return func(t testing.TB) {
@@ -178,28 +115,6 @@ func MakeBucket(bucket string, exists func(string) (bool, error), make func(stri
 	}
 }
 
-// ErrorCode returns the response code as string if
-// the err is a minio.ErrorResponse. It returns
-// a boolean flag indicating whether the provided error
-// is a minio.ErrorResponse.
-func ErrorCode(err error) (string, bool) {
-	if errResp, ok := err.(minio.ErrorResponse); ok {
-		return errResp.Code, ok
-	}
-	return "", false
-}
-
-// ErrorMessage returns the response message as string if
-// the err is a minio.ErrorResponse. It returns
-// a boolean flag indicating whether the provided error
-// is a minio.ErrorResponse.
-func ErrorMessage(err error) (string, bool) {
-	if errResp, ok := err.(minio.ErrorResponse); ok {
-		return errResp.Message, ok
-	}
-	return "", false
-}
-
 // RemoveObject removes the object at the bucket using the remove function.
 // If the remove function returns a error RemoveObject() fails the test.
 //
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Seed returns the seed of the current test run. Object names
+// and the pseudorandom data returned by Rand are derived from
+// the seed such that a failed run can be reproduced by running
+// the tests again with the same seed. The run ID - and therefore
+// the bucket names - differ on every run. See: RunID
+//
+// The seed is taken from the '-seed' CLI argument. If not
+// provided, Seed picks a random seed. Tests using Rand or
+// Targets.Run log the seed when they fail. Like Parse, Seed
+// may parse flag.CommandLine and therefore must not be called
+// during package initialization.
+func Seed() int64 {
+	seedOnce.Do(func() {
+		if seed = parseFlags().seed; seed == 0 {
+			var b [8]byte
+			cryptorand.Read(b[:])
+			seed = int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+		}
+	})
+	return seed
+}
+
+// Rand returns a pseudorandom number generator derived from the
+// Seed and the name of the test. Each call returns a different
+// generator but a test produces the same sequence of generators
+// on every run with the same seed - independent of the order in
+// which tests run. If the test fails, the seed is logged.
+func Rand(t testing.TB) *rand.Rand {
+	reportSeed(t)
+	return newRand(nextName("test/" + t.Name()))
+}
+
+// ObjectName returns an object name with the given prefix
+// and a pseudorandom hex suffix derived from the Seed -
+// e.g. 'object-1a2b3c4d'.
+func ObjectName(prefix string) string {
+	return prefix + "-" + randomHex(newRand(nextName("object/"+prefix)))
+}
+
+var (
+	seedOnce sync.Once
+	seed     int64
+
+	namesLock sync.Mutex
+	names     = map[string]int{}
+
+	reported sync.Map // The running tests which log the seed on failure.
+)
+
+// reportSeed logs the seed if the test fails. The test
+// is forgotten once it has finished.
+func reportSeed(t testing.TB) {
+	if _, ok := reported.LoadOrStore(t, true); ok {
+		return
+	}
+	t.Cleanup(func() {
+		reported.Delete(t)
+		if t.Failed() {
+			t.Logf("Seed: %d - run the tests with '-seed %d' to reproduce the failure", Seed(), Seed())
+		}
+	})
+}
+
+// nextName returns the name with a counter of how often
+// nextName has been called with the same name before.
+// Deriving generators from it - instead of from a shared
+// generator - keeps generated names and data independent
+// of the order in which concurrent tests run.
+func nextName(name string) string {
+	namesLock.Lock()
+	n := names[name]
+	names[name] = n + 1
+	namesLock.Unlock()
+	return name + "#" + strconv.Itoa(n)
+}
+
+// newRand returns a pseudorandom number generator
+// derived from the Seed and the name.
+func newRand(name string) *rand.Rand {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(Seed()))
+
+	h := fnv.New64a()
+	h.Write(b[:])
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// randomHex returns 8 pseudorandom hex characters.
+func randomHex(r *rand.Rand) string {
+	var b [4]byte
+	r.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
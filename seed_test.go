@@ -0,0 +1,39 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+func TestRand(t *testing.T) {
+	if s3.Seed() != s3.Seed() {
+		t.Fatal("Seed returned different seeds")
+	}
+
+	a, b := make([]byte, 64), make([]byte, 64)
+	s3.Rand(t).Read(a)
+	s3.Rand(t).Read(b)
+	if bytes.Equal(a, make([]byte, len(a))) {
+		t.Fatal("Rand returned all-zero data")
+	}
+	if bytes.Equal(a, b) {
+		t.Fatal("Rand returned the same generator twice")
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	a, b := s3.ObjectName("object"), s3.ObjectName("object")
+	if !strings.HasPrefix(a, "object-") || len(a) != len("object-")+8 {
+		t.Fatalf("Invalid object name '%s'", a)
+	}
+	if a == b {
+		t.Fatalf("ObjectName returned the same name twice: '%s'", a)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var expiredCredentials = flag.String("expiredCredentials", "", "Expired temporary S3 credentials as 'access-key:secret-key:session-token'.")
+
+func TestInvalidSessionToken(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testInvalidSessionToken)
+}
+
+func testInvalidSessionToken(t *testing.T, config s3.Config) {
+	creds, err := config.Credentials()
+	if err != nil {
+		t.Fatalf("Failed to retrieve credentials: %v", err)
+	}
+	config.Provider = nil
+	config.AccessKey, config.SecretKey, config.SessionToken = creds.AccessKey, creds.SecretKey, "invalid-session-token"
+	client := config.NewClient(t)
+	_, err = client.ListBuckets()
+	s3.ErrInvalidToken.Expect(t, err)
+}
+
+func TestExpiredSessionToken(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *expiredCredentials == "" {
+		t.Skip("Skipping test because no -expiredCredentials are provided")
+	}
+	parts := strings.SplitN(*expiredCredentials, ":", 3)
+	if len(parts) != 3 {
+		t.Fatal("Invalid -expiredCredentials: expected 'access-key:secret-key:session-token'")
+	}
+	targets.Run(t, func(t *testing.T, config s3.Config) {
+		config.Provider = nil
+		config.AccessKey, config.SecretKey, config.SessionToken = parts[0], parts[1], parts[2]
+		client := config.NewClient(t)
+		_, err := client.ListBuckets()
+		s3.ErrExpiredToken.Expect(t, err)
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultProfile is the name of the AWS profile used
+// if no profile is specified explicitly.
+const DefaultProfile = "default"
+
+// Credentials are the S3 access credentials.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// EnvCredentials returns the credentials specified by the
+// 'AWS_ACCESS_KEY_ID', 'AWS_SECRET_ACCESS_KEY' and
+// 'AWS_SESSION_TOKEN' env. variables. It returns false
+// if either no access key or no secret key is exported.
+func EnvCredentials() (Credentials, bool) {
+	creds := Credentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	return creds, creds.AccessKey != "" && creds.SecretKey != ""
+}
+
+// SharedCredentials returns the credentials of the AWS profile
+// from the AWS shared credentials file and the AWS config file.
+// If profile is empty the profile specified by the 'AWS_PROFILE'
+// env. variable or - if not set - the DefaultProfile is used.
+//
+// The shared credentials file is '~/.aws/credentials' unless
+// the 'AWS_SHARED_CREDENTIALS_FILE' env. variable is set. The config
+// file is '~/.aws/config' unless the 'AWS_CONFIG_FILE' env. variable
+// is set. Values in the credentials file take precedence over values
+// in the config file.
+func SharedCredentials(profile string) (Credentials, error) {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	credentialsFile, configFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), os.Getenv("AWS_CONFIG_FILE")
+	if home := homeDir(); home != "" {
+		if credentialsFile == "" {
+			credentialsFile = filepath.Join(home, ".aws", "credentials")
+		}
+		if configFile == "" {
+			configFile = filepath.Join(home, ".aws", "config")
+		}
+	}
+
+	// The config file prefixes all profiles except the
+	// default profile with 'profile ' - e.g. [profile dev].
+	configSection := profile
+	if profile != DefaultProfile {
+		configSection = "profile " + profile
+	}
+
+	var (
+		creds Credentials
+		found bool
+	)
+	for _, file := range []struct{ Path, Section string }{
+		{Path: configFile, Section: configSection},
+		{Path: credentialsFile, Section: profile},
+	} {
+		if file.Path == "" {
+			continue
+		}
+		section, err := readINISection(file.Path, file.Section)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Credentials{}, err
+		}
+		if section == nil {
+			continue
+		}
+		found = true
+		if v, ok := section["aws_access_key_id"]; ok {
+			creds.AccessKey = v
+		}
+		if v, ok := section["aws_secret_access_key"]; ok {
+			creds.SecretKey = v
+		}
+		if v, ok := section["aws_session_token"]; ok {
+			creds.SessionToken = v
+		}
+	}
+	if !found {
+		return Credentials{}, errors.New("The AWS profile '" + profile + "' does not exist")
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, errors.New("The AWS profile '" + profile + "' does not contain an access key and secret key")
+	}
+	return creds, nil
+}
+
+// awsCredentials returns the AWS credentials exported as env.
+// variables or - if none are exported or a profile is specified
+// explicitly - the credentials of the AWS profile.
+func awsCredentials(profile string) (Credentials, error) {
+	if creds, ok := EnvCredentials(); ok && profile == "" {
+		return creds, nil
+	}
+	return SharedCredentials(profile)
+}
+
+// readINISection returns the key-value pairs of the section
+// within the INI file at path. It returns nil if the file
+// does not contain the section.
+func readINISection(path, section string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values, err := parseINISection(file, section)
+	if err != nil {
+		return nil, errors.New("Failed to parse '" + path + "': " + err.Error())
+	}
+	return values, nil
+}
+
+func parseINISection(r io.Reader, section string) (map[string]string, error) {
+	var (
+		values  map[string]string
+		current string
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.New("invalid section header '" + line + "'")
+			}
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if current == section && values == nil {
+				values = map[string]string{}
+			}
+		case current == section:
+			i := strings.Index(line, "=")
+			if i < 0 {
+				return nil, errors.New("invalid line '" + line + "'")
+			}
+			values[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return values, scanner.Err()
+}
+
+func homeDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("USERPROFILE")
+	}
+	return os.Getenv("HOME")
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+const sharedCredentialsFile = `
+[default]
+aws_access_key_id = default-access-key
+aws_secret_access_key = default-secret-key
+
+# A profile with temporary credentials
+[dev]
+aws_access_key_id=dev-access-key
+aws_secret_access_key=dev-secret-key
+aws_session_token=dev-session-token
+
+[partial]
+aws_access_key_id = partial-access-key
+`
+
+const sharedConfigFile = `
+[default]
+region = us-east-1
+
+[profile partial]
+aws_secret_access_key = partial-secret-key
+
+[profile config-only]
+aws_access_key_id = config-access-key
+aws_secret_access_key = config-secret-key
+
+[profile empty]
+region = eu-west-1
+`
+
+var sharedCredentialsTests = []struct {
+	Profile    string
+	EnvProfile string
+	Creds      s3.Credentials
+	ShouldFail bool
+}{
+	{Profile: "", Creds: s3.Credentials{AccessKey: "default-access-key", SecretKey: "default-secret-key"}},                                  // 0
+	{Profile: "default", Creds: s3.Credentials{AccessKey: "default-access-key", SecretKey: "default-secret-key"}},                           // 1
+	{Profile: "dev", Creds: s3.Credentials{AccessKey: "dev-access-key", SecretKey: "dev-secret-key", SessionToken: "dev-session-token"}},    // 2
+	{EnvProfile: "dev", Creds: s3.Credentials{AccessKey: "dev-access-key", SecretKey: "dev-secret-key", SessionToken: "dev-session-token"}}, // 3
+	{Profile: "default", EnvProfile: "dev", Creds: s3.Credentials{AccessKey: "default-access-key", SecretKey: "default-secret-key"}},        // 4
+	{Profile: "partial", Creds: s3.Credentials{AccessKey: "partial-access-key", SecretKey: "partial-secret-key"}},                           // 5
+	{Profile: "config-only", Creds: s3.Credentials{AccessKey: "config-access-key", SecretKey: "config-secret-key"}},                         // 6
+	{Profile: "empty", ShouldFail: true},          // 7
+	{Profile: "does-not-exist", ShouldFail: true}, // 8
+}
+
+func TestSharedCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-aws")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentialsFile, configFile := filepath.Join(dir, "credentials"), filepath.Join(dir, "config")
+	if err = ioutil.WriteFile(credentialsFile, []byte(sharedCredentialsFile), 0600); err != nil {
+		t.Fatalf("Failed to write credentials file: %s", err)
+	}
+	if err = ioutil.WriteFile(configFile, []byte(sharedConfigFile), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %s", err)
+	}
+	defer setEnv(t, "AWS_SHARED_CREDENTIALS_FILE", credentialsFile)()
+	defer setEnv(t, "AWS_CONFIG_FILE", configFile)()
+
+	for i, test := range sharedCredentialsTests {
+		restore := setEnv(t, "AWS_PROFILE", test.EnvProfile)
+		creds, err := s3.SharedCredentials(test.Profile)
+		restore()
+
+		if err != nil && !test.ShouldFail {
+			t.Errorf("Test %d: Failed to load shared credentials: %s", i, err)
+			continue
+		}
+		if err == nil && test.ShouldFail {
+			t.Errorf("Test %d: Loading shared credentials should fail but succeeded", i)
+			continue
+		}
+		if creds != test.Creds {
+			t.Errorf("Test %d: Credentials mismatch: got %v - want %v", i, creds, test.Creds)
+		}
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	defer setEnv(t, "AWS_ACCESS_KEY_ID", "env-access-key")()
+	defer setEnv(t, "AWS_SECRET_ACCESS_KEY", "env-secret-key")()
+	defer setEnv(t, "AWS_SESSION_TOKEN", "env-session-token")()
+
+	creds, ok := s3.EnvCredentials()
+	if !ok {
+		t.Fatal("Failed to load env. credentials")
+	}
+	if want := (s3.Credentials{AccessKey: "env-access-key", SecretKey: "env-secret-key", SessionToken: "env-session-token"}); creds != want {
+		t.Fatalf("Credentials mismatch: got %v - want %v", creds, want)
+	}
+
+	defer setEnv(t, "AWS_SECRET_ACCESS_KEY", "")()
+	if _, ok = s3.EnvCredentials(); ok {
+		t.Fatal("Env. credentials without secret key must not be valid")
+	}
+}
+
+// setEnv sets the env. variable key to value - or unsets
+// it if value is empty - and returns a function which
+// restores the previous value.
+func setEnv(t *testing.T, key, value string) func() {
+	prev, ok := os.LookupEnv(key)
+	var err error
+	if value == "" {
+		err = os.Unsetenv(key)
+	} else {
+		err = os.Setenv(key, value)
+	}
+	if err != nil {
+		t.Fatalf("Failed to set env. variable '%s': %s", key, err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
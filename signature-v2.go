@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// subResourcesV2 are the query parameters which are
+// part of the canonical resource of AWS signature V2.
+var subResourcesV2 = []string{
+	"acl", "cors", "delete", "encryption", "legal-hold", "lifecycle",
+	"location", "logging", "notification", "object-lock", "partNumber",
+	"policy", "replication", "requestPayment", "response-cache-control",
+	"response-content-disposition", "response-content-encoding",
+	"response-content-language", "response-content-type", "response-expires",
+	"restore", "retention", "select", "select-type", "tagging", "torrent",
+	"uploadId", "uploads", "versionId", "versioning", "versions", "website",
+}
+
+// signV2 signs the request with the credentials using AWS
+// signature V2. The bucket must be set for virtual-host-style
+// requests - which don't contain the bucket in the URL path -
+// and must be empty for path-style requests. If the request
+// has no Date header, signV2 sets it to t.
+func signV2(req *http.Request, creds Credentials, bucket string, t time.Time) {
+	req.Header.Del("Authorization")
+	req.Header.Del("X-Amz-Date")
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", t.UTC().Format(http.TimeFormat))
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Md5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+		canonicalHeadersV2(req) + canonicalResourceV2(req, bucket),
+	}, "\n")
+	mac := hmac.New(sha1.New, []byte(creds.SecretKey))
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Authorization", "AWS "+creds.AccessKey+":"+signature)
+}
+
+func canonicalHeadersV2(req *http.Request) string {
+	headers := map[string][]string{}
+	for key, values := range req.Header {
+		if key = strings.ToLower(key); strings.HasPrefix(key, "x-amz-") {
+			headers[key] = append(headers[key], values...)
+		}
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonical bytes.Buffer
+	for _, key := range keys {
+		values := make([]string, len(headers[key]))
+		for i, v := range headers[key] {
+			values[i] = strings.TrimSpace(v)
+		}
+		canonical.WriteString(key + ":" + strings.Join(values, ",") + "\n")
+	}
+	return canonical.String()
+}
+
+func canonicalResourceV2(req *http.Request, bucket string) string {
+	resource := encodePath(req.URL.Path)
+	if bucket != "" {
+		resource = "/" + bucket + resource
+	}
+
+	query := req.URL.Query()
+	var subResources []string
+	for _, key := range subResourcesV2 { // subResourcesV2 is sorted
+		values, ok := query[key]
+		if !ok {
+			continue
+		}
+		if len(values) == 0 || values[0] == "" {
+			subResources = append(subResources, key)
+		} else {
+			subResources = append(subResources, key+"="+values[0])
+		}
+	}
+	if len(subResources) > 0 {
+		resource += "?" + strings.Join(subResources, "&")
+	}
+	return resource
+}
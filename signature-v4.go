@@ -0,0 +1,355 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signV4Algorithm = "AWS4-HMAC-SHA256"
+	iso8601Format   = "20060102T150405Z"
+	yyyymmdd        = "20060102"
+
+	// emptySHA256 is the hex-encoded SHA-256 hash of an empty payload.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signV4 signs the request with the credentials using AWS
+// signature V4 for the given region and service. The payloadHash
+// is the hex-encoded SHA-256 hash of the request body or a special
+// value like 'UNSIGNED-PAYLOAD'.
+//
+// All headers of the request, except the 'Authorization' and
+// 'User-Agent' header, are signed. It returns the hex-encoded
+// signature - e.g. the seed signature of a chunked upload.
+func signV4(req *http.Request, creds Credentials, region, service, payloadHash string, t time.Time) string {
+	t = t.UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", t.Format(iso8601Format))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	signedHeaders, canonicalHeaders := canonicalHeadersV4(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		encodePath(req.URL.Path),
+		canonicalQueryV4(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format(yyyymmdd), region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		t.Format(iso8601Format),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := signingKeyV4(creds.SecretKey, region, service, t)
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", signV4Algorithm+" Credential="+creds.AccessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return signature
+}
+
+// signingKeyV4 derives the AWS signature V4 signing key
+// for the region and service at the day of t.
+func signingKeyV4(secretKey, region, service string, t time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), t.UTC().Format(yyyymmdd))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func canonicalHeadersV4(req *http.Request) (signedHeaders, canonicalHeaders string) {
+	headers := map[string][]string{"host": {req.Host}}
+	for key, values := range req.Header {
+		switch key = strings.ToLower(key); key {
+		case "authorization", "user-agent":
+			continue
+		}
+		headers[key] = append(headers[key], values...)
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonical bytes.Buffer
+	for _, key := range keys {
+		values := make([]string, len(headers[key]))
+		for i, v := range headers[key] {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		canonical.WriteString(key + ":" + strings.Join(values, ",") + "\n")
+	}
+	return strings.Join(keys, ";"), canonical.String()
+}
+
+func canonicalQueryV4(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, encodeQuery(key)+"="+encodeQuery(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// encodePath URI-encodes the path as required by AWS signature V4.
+// All characters except the unreserved characters and '/' are encoded.
+func encodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+func encodeQuery(s string) string { return uriEncode(s, true) }
+
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var encoded bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			encoded.WriteByte('%')
+			encoded.WriteByte(hexDigits[c>>4])
+			encoded.WriteByte(hexDigits[c&15])
+		}
+	}
+	return encoded.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+const (
+	// streamingPayload is the payload hash of requests
+	// which send a chunked payload signed chunk by chunk.
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	// streamingAlgorithm is the algorithm of chunk signatures.
+	streamingAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	// streamingChunkSize is the size of all chunks except the last.
+	streamingChunkSize = 64 * 1024
+)
+
+// signV4Streaming signs the request with the credentials using
+// AWS signature V4 with a chunked payload for the given region.
+// It replaces the request body with a reader which produces the
+// 'aws-chunked' encoding of the body while it is read. Each chunk
+// is signed using the signature of the previous chunk - starting
+// with the signature of the request (seed).
+func signV4Streaming(req *http.Request, creds Credentials, region string, t time.Time) {
+	t = t.UTC()
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+		req.Header.Set("Content-Encoding", "aws-chunked,"+encoding)
+	} else {
+		req.Header.Set("Content-Encoding", "aws-chunked")
+	}
+	size, body := req.ContentLength, req.Body
+	if body == nil {
+		size, body = 0, http.NoBody
+	}
+	req.Header.Set("X-Amz-Content-Sha256", streamingPayload)
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(size, 10))
+	signature := signV4(req, creds, region, "s3", streamingPayload, t)
+
+	chunkSize := int64(streamingChunkSize)
+	if size < chunkSize {
+		chunkSize = size
+	}
+	req.ContentLength = streamingContentLength(size)
+	req.Body = &streamingReader{
+		body:      body,
+		remaining: size,
+		key:       signingKeyV4(creds.SecretKey, region, "s3", t),
+		prefix:    strings.Join([]string{streamingAlgorithm, t.Format(iso8601Format), t.Format(yyyymmdd) + "/" + region + "/s3/aws4_request"}, "\n"),
+		signature: signature,
+		chunk:     make([]byte, chunkSize),
+	}
+}
+
+// streamingContentLength returns the length of the
+// 'aws-chunked' encoding of a payload of size bytes.
+func streamingContentLength(size int64) int64 {
+	// Each chunk has a header '<hex size>;chunk-signature=<signature>\r\n'
+	// and is followed by '\r\n'. The last chunk is empty.
+	const overhead = int64(len(";chunk-signature=") + 2*sha256.Size + 2 + 2)
+
+	chunks := size / streamingChunkSize
+	length := chunks * (int64(len(strconv.FormatInt(streamingChunkSize, 16))) + overhead + streamingChunkSize)
+	if n := size % streamingChunkSize; n > 0 {
+		length += int64(len(strconv.FormatInt(n, 16))) + overhead + n
+	}
+	return length + 1 + overhead
+}
+
+// streamingReader produces the 'aws-chunked' encoding of a
+// payload. It reads and signs one chunk at a time such that
+// the payload never has to be kept in memory.
+type streamingReader struct {
+	body      io.ReadCloser
+	remaining int64 // The number of payload bytes not read yet
+
+	key       []byte
+	prefix    string // The string to sign without the signature and hashes
+	signature string // The signature of the previous chunk
+
+	chunk   []byte
+	encoded []byte
+	buffer  []byte // The encoded bytes not read yet
+	done    bool
+}
+
+func (r *streamingReader) Read(p []byte) (int, error) {
+	for len(r.buffer) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func (r *streamingReader) Close() error { return r.body.Close() }
+
+// nextChunk reads, signs and encodes the next chunk.
+// The last chunk is empty.
+func (r *streamingReader) nextChunk() error {
+	data := r.chunk
+	if int64(len(data)) > r.remaining {
+		data = data[:r.remaining]
+	}
+	if _, err := io.ReadFull(r.body, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.remaining -= int64(len(data))
+
+	stringToSign := r.prefix + "\n" + r.signature + "\n" + emptySHA256 + "\n" + sha256Hex(data)
+	r.signature = hex.EncodeToString(hmacSHA256(r.key, stringToSign))
+
+	r.encoded = append(r.encoded[:0], strconv.FormatInt(int64(len(data)), 16)+";chunk-signature="+r.signature+"\r\n"...)
+	r.encoded = append(r.encoded, data...)
+	r.encoded = append(r.encoded, "\r\n"...)
+	r.buffer, r.done = r.encoded, len(data) == 0
+	return nil
+}
+
+// decodeChunked returns a reader which decodes the 'aws-chunked'
+// encoded payload read from r. It does not verify the chunk
+// signatures and ignores any trailing headers after the last chunk.
+func decodeChunked(r io.Reader) io.Reader {
+	return &chunkedDecoder{reader: bufio.NewReader(r)}
+}
+
+type chunkedDecoder struct {
+	reader    *bufio.Reader
+	remaining int64 // The number of bytes of the current chunk not read yet
+	done      bool
+	err       error
+}
+
+var (
+	errMissingChunkHeader = errors.New("Invalid aws-chunked payload: missing chunk header")
+	errInvalidChunkSize   = errors.New("Invalid aws-chunked payload: invalid chunk size")
+	errTruncatedChunk     = errors.New("Invalid aws-chunked payload: truncated chunk")
+)
+
+func (d *chunkedDecoder) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	for d.remaining == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if d.err = d.nextChunk(); d.err != nil {
+			return 0, d.err
+		}
+	}
+
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.reader.Read(p)
+	if d.remaining -= int64(n); d.remaining == 0 && err == nil {
+		var crlf [2]byte
+		if _, err = io.ReadFull(d.reader, crlf[:]); err == nil && string(crlf[:]) != "\r\n" {
+			err = errTruncatedChunk
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errTruncatedChunk
+	}
+	d.err = err
+	return n, err
+}
+
+// nextChunk parses the next chunk header.
+func (d *chunkedDecoder) nextChunk() error {
+	header, err := d.reader.ReadString('\n')
+	if err != nil || !strings.HasSuffix(header, "\r\n") {
+		return errMissingChunkHeader
+	}
+	header = strings.TrimSuffix(header, "\r\n")
+	if i := strings.IndexByte(header, ';'); i >= 0 {
+		header = header[:i]
+	}
+	size, err := strconv.ParseInt(header, 16, 64)
+	if err != nil || size < 0 {
+		return errInvalidChunkSize
+	}
+	d.remaining, d.done = size, size == 0
+	return nil
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the AWS signature scheme used to sign S3 requests.
+type Signature string
+
+const (
+	// SignatureV2 signs requests with AWS signature V2.
+	SignatureV2 Signature = "v2"
+	// SignatureV4 signs requests and their payload
+	// with AWS signature V4.
+	SignatureV4 Signature = "v4"
+	// SignatureV4UnsignedPayload signs requests with AWS
+	// signature V4 but not their payload ('UNSIGNED-PAYLOAD').
+	SignatureV4UnsignedPayload Signature = "v4-unsigned-payload"
+	// SignatureV4Streaming sends object uploads as chunked payload
+	// signed chunk by chunk ('STREAMING-AWS4-HMAC-SHA256-PAYLOAD').
+	// All other requests are signed as with SignatureV4.
+	SignatureV4Streaming Signature = "v4-streaming"
+	// SignatureAll runs every test once per signature
+	// scheme in Signatures. See: Targets.Run
+	SignatureAll Signature = "all"
+)
+
+// Signatures contains all signature schemes.
+var Signatures = []Signature{SignatureV2, SignatureV4, SignatureV4UnsignedPayload, SignatureV4Streaming}
+
+// signer is a http.RoundTripper which replaces the signature
+// of S3 requests - computed by a client library - with a
+// signature of a particular signature scheme.
+type signer struct {
+	transport   http.RoundTripper
+	signature   Signature
+	region      string
+	host        string // The hostname of the endpoint
+	credentials func() (Credentials, error)
+}
+
+// newSigner returns a http.RoundTripper which signs all
+// requests sent through transport with the signature scheme
+// of the config. It returns transport if the config does not
+// specify a particular signature scheme.
+func (c *Config) newSigner(transport http.RoundTripper) http.RoundTripper {
+	if c.Signature == "" || c.Signature == SignatureAll {
+		return transport
+	}
+	host := c.Endpoint
+	if h, _, err := net.SplitHostPort(c.Endpoint); err == nil {
+		host = h
+	}
+	return &signer{
+		transport:   transport,
+		signature:   c.Signature,
+		region:      c.region(),
+		host:        host,
+		credentials: c.Credentials,
+	}
+}
+
+func (s *signer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, size, err := requestPayload(req)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s.credentials()
+	if err != nil {
+		closePayload(body)
+		return nil, err
+	}
+
+	bucket, object, virtualHost := s.resource(req)
+	streaming := s.signature == SignatureV4Streaming && req.Method == http.MethodPut && object != "" && req.Header.Get("X-Amz-Copy-Source") == ""
+	payloadHash := unsignedPayload
+	switch {
+	case size < 0:
+		body, size, payloadHash, err = spoolPayload(body)
+	case s.signature != SignatureV2 && s.signature != SignatureV4UnsignedPayload && !streaming:
+		body, payloadHash, err = hashPayload(body, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	for _, header := range []string{"Authorization", "Date", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Decoded-Content-Length", "X-Amz-Trailer"} {
+		req.Header.Del(header)
+	}
+	if encoding := req.Header.Get("Content-Encoding"); strings.HasPrefix(encoding, "aws-chunked") {
+		if encoding = strings.TrimPrefix(strings.TrimPrefix(encoding, "aws-chunked"), ","); encoding == "" {
+			req.Header.Del("Content-Encoding")
+		} else {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+	}
+	req.TransferEncoding, req.GetBody = nil, nil
+	req.Body, req.ContentLength = body, size
+	if size == 0 {
+		closePayload(body)
+		req.Body = nil
+	}
+
+	now := time.Now()
+	switch {
+	case s.signature == SignatureV2:
+		if !virtualHost {
+			bucket = "" // Path-style requests contain the bucket in the URL path
+		}
+		signV2(req, creds, bucket, now)
+	case s.signature == SignatureV4UnsignedPayload:
+		req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+		signV4(req, creds, s.region, "s3", unsignedPayload, now)
+	case streaming:
+		signV4Streaming(req, creds, s.region, now)
+	default:
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		signV4(req, creds, s.region, "s3", payloadHash, now)
+	}
+	return s.transport.RoundTrip(req)
+}
+
+// resource returns the bucket and object addressed by the
+// request and whether it is a virtual-host-style request.
+func (s *signer) resource(req *http.Request) (bucket, object string, virtualHost bool) {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if host := req.URL.Hostname(); strings.HasSuffix(host, "."+s.host) {
+		return strings.TrimSuffix(host, "."+s.host), path, true
+	}
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:], false
+	}
+	return path, "", false
+}
+
+// maxMemoryPayload is the max. size of payloads which
+// spoolPayload keeps in memory instead of a temp. file.
+const maxMemoryPayload = 1 << 20
+
+// requestPayload returns the payload of the request and its
+// size. It decodes chunked payloads - e.g. sent by clients using
+// streaming signatures - while they are read. The size is -1 if
+// it is unknown. The returned payload is nil if the request has
+// no body.
+func requestPayload(req *http.Request) (io.ReadCloser, int64, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 0, nil
+	}
+	if !strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		if req.ContentLength <= 0 { // For client requests 0 means unknown if the body is not nil
+			return req.Body, -1, nil
+		}
+		return req.Body, req.ContentLength, nil
+	}
+	size, err := strconv.ParseInt(req.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil || size < 0 {
+		size = -1
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decodeChunked(req.Body), req.Body}, size, nil
+}
+
+// hashPayload returns the payload and the hex-encoded SHA-256
+// hash of its size bytes. If the payload implements io.Seeker
+// it is hashed and rewound. Otherwise, it is spooled.
+func hashPayload(payload io.ReadCloser, size int64) (io.ReadCloser, string, error) {
+	if payload == nil || size == 0 {
+		return payload, emptySHA256, nil
+	}
+	seeker, ok := payload.(io.Seeker)
+	if !ok {
+		payload, _, hash, err := spoolPayload(payload)
+		return payload, hash, err
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		payload.Close()
+		return nil, "", err
+	}
+	h := sha256.New()
+	if _, err = io.CopyN(h, payload, size); err != nil {
+		payload.Close()
+		return nil, "", err
+	}
+	if _, err = seeker.Seek(offset, io.SeekStart); err != nil {
+		payload.Close()
+		return nil, "", err
+	}
+	return payload, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// spoolPayload reads and closes the payload and returns a
+// rewound copy, its size and its hex-encoded SHA-256 hash.
+// Payloads larger than maxMemoryPayload are copied into a
+// temp. file which is removed when the copy is closed.
+func spoolPayload(payload io.ReadCloser) (io.ReadCloser, int64, string, error) {
+	if payload == nil {
+		return nil, 0, emptySHA256, nil
+	}
+	defer payload.Close()
+
+	var (
+		h      = sha256.New()
+		buffer bytes.Buffer
+	)
+	n, err := io.CopyN(&buffer, io.TeeReader(payload, h), maxMemoryPayload+1)
+	if err == io.EOF {
+		return ioutil.NopCloser(&buffer), n, hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	file, err := ioutil.TempFile("", "s3-payload-")
+	if err != nil {
+		return nil, 0, "", err
+	}
+	spooled := tempFile{file}
+	if _, err = buffer.WriteTo(file); err != nil {
+		spooled.Close()
+		return nil, 0, "", err
+	}
+	m, err := io.Copy(file, io.TeeReader(payload, h))
+	if err != nil {
+		spooled.Close()
+		return nil, 0, "", err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return nil, 0, "", err
+	}
+	return spooled, n + m, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// tempFile is a temp. file which is removed when closed.
+type tempFile struct{ *os.File }
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func closePayload(payload io.ReadCloser) {
+	if payload != nil {
+		payload.Close()
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// captureTransport is a http.RoundTripper which reads the
+// request body and responds with an empty 200 OK response.
+type captureTransport struct {
+	req  *http.Request
+	body []byte
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.req, t.body = req, nil
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.body = body
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+var signerPayloadTests = []struct {
+	Signature Signature
+	Size      int
+	Seekable  bool // The body implements io.Seeker
+	Chunked   bool // The body is 'aws-chunked' encoded by the client
+}{
+	{Signature: SignatureV4, Size: 0},                                              // 0
+	{Signature: SignatureV4, Size: 1024},                                           // 1
+	{Signature: SignatureV4, Size: 1024, Seekable: true},                           // 2
+	{Signature: SignatureV4, Size: maxMemoryPayload + 1},                           // 3
+	{Signature: SignatureV4, Size: maxMemoryPayload + 1, Seekable: true},           // 4
+	{Signature: SignatureV4, Size: streamingChunkSize + 1, Chunked: true},          // 5
+	{Signature: SignatureV4Streaming, Size: 0},                                     // 6
+	{Signature: SignatureV4Streaming, Size: 3*streamingChunkSize + 7},              // 7
+	{Signature: SignatureV4Streaming, Size: 2 * streamingChunkSize, Chunked: true}, // 8
+	{Signature: SignatureV4UnsignedPayload, Size: 1024},                            // 9
+	{Signature: SignatureV2, Size: 1024, Chunked: true},                            // 10
+}
+
+func TestSignerPayload(t *testing.T) {
+	creds := Credentials{AccessKey: "access-key", SecretKey: "secret-key"}
+	for i, test := range signerPayloadTests {
+		transport := &captureTransport{}
+		config := Config{Endpoint: "localhost:9000", Signature: test.Signature, AccessKey: creds.AccessKey, SecretKey: creds.SecretKey}
+		signer := config.newSigner(transport)
+
+		data := bytes.Repeat([]byte{'a'}, test.Size)
+		req, err := http.NewRequest(http.MethodPut, "https://localhost:9000/bucket/object", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Failed to create request: %s", i, err)
+		}
+		if test.Size > 0 {
+			req.Body, req.ContentLength = ioutil.NopCloser(bytes.NewReader(data)), int64(test.Size)
+			if test.Seekable {
+				req.Body = seekableBody{io.NewSectionReader(bytes.NewReader(data), 0, int64(test.Size))}
+			}
+		}
+		if test.Chunked {
+			signV4Streaming(req, creds, DefaultRegion, time.Now())
+		}
+		if _, err = signer.RoundTrip(req); err != nil {
+			t.Fatalf("Test %d: Failed to send request: %s", i, err)
+		}
+
+		body, header := transport.body, transport.req.Header
+		if transport.req.ContentLength != int64(len(body)) {
+			t.Fatalf("Test %d: Content length mismatch: got %d - want %d", i, transport.req.ContentLength, len(body))
+		}
+		switch test.Signature {
+		case SignatureV4:
+			if hash := header.Get("X-Amz-Content-Sha256"); hash != sha256Hex(data) {
+				t.Fatalf("Test %d: Payload hash mismatch: got %s - want %s", i, hash, sha256Hex(data))
+			}
+		case SignatureV4Streaming:
+			if length := header.Get("X-Amz-Decoded-Content-Length"); length != strconv.Itoa(test.Size) {
+				t.Fatalf("Test %d: Decoded content length mismatch: got %s - want %d", i, length, test.Size)
+			}
+			if body, err = ioutil.ReadAll(decodeChunked(bytes.NewReader(body))); err != nil {
+				t.Fatalf("Test %d: Failed to decode payload: %s", i, err)
+			}
+		}
+		if !bytes.Equal(body, data) {
+			t.Fatalf("Test %d: Payload does not match the original data", i)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var large = flag.Int("large", 0, "The level of the object size limit tests: 0 disables them, 1 checks the part limits, 2 uploads objects of up to 5 GB and 3 creates objects of up to 5 TB using server-side copies.")
+
+const (
+	largeParts  = 1 // Checks the part size and part number limits. Uploads a few MB.
+	largePut    = 2 // Checks the single PUT limit. Uploads about 15 GB.
+	largeObject = 3 // Checks the object size limit. Creates about 10 TB using server-side copies.
+)
+
+// requireLarge skips the test if the -large level is less than level.
+func requireLarge(t *testing.T, level int) {
+	if *large < level {
+		t.Skipf("Skipping test because -large is less than %d", level)
+	}
+}
+
+// The size limit tests use the HTTP Store since client
+// libraries may reject sizes exceeding the S3 limits before
+// sending any request.
+
+var partSizeLimitTests = []struct {
+	Parts []int64      // The sizes of the parts.
+	Err   *s3.APIError // The expected error, if any.
+}{
+	{Parts: []int64{1}},                 // 0
+	{Parts: []int64{s3.MinPartSize, 1}}, // 1
+	{Parts: []int64{s3.MinPartSize, s3.MinPartSize, s3.MinPartSize - 1}}, // 2
+	{Parts: []int64{s3.MinPartSize - 1, 1}, Err: &s3.ErrEntityTooSmall},  // 3
+	{Parts: []int64{s3.MinPartSize, 1, 1}, Err: &s3.ErrEntityTooSmall},   // 4
+	{Parts: []int64{1, s3.MinPartSize}, Err: &s3.ErrEntityTooSmall},      // 5
+}
+
+func TestPartSizeLimits(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireLarge(t, largeParts)
+	targets.Run(t, func(t *testing.T, config s3.Config) {
+		store := config.NewStore(t, s3.StoreHTTP)
+		bucket := s3.BucketName("test-part-size-limits")
+		config.MakeTestBucket(t, store, bucket)
+
+		for i, test := range partSizeLimitTests {
+			var size int64
+			for _, partSize := range test.Parts {
+				size += partSize
+			}
+			object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), size)
+			uploadID, err := store.NewMultipartUpload(bucket, object, s3.PutOptions{})
+			if err != nil {
+				t.Fatalf("Test %d: Failed to create multipart upload for '%s/%s': %s", i, bucket, object, err)
+			}
+
+			var (
+				parts  []s3.Part
+				offset int64
+			)
+			for j, partSize := range test.Parts {
+				part, err := store.PutObjectPart(bucket, object, uploadID, j+1, io.NewSectionReader(payload, offset, partSize), partSize, nil)
+				if err != nil {
+					store.AbortMultipartUpload(bucket, object, uploadID)
+					t.Fatalf("Test %d: Failed to upload part %d of '%s/%s': %s", i, j+1, bucket, object, err)
+				}
+				parts, offset = append(parts, part), offset+partSize
+			}
+
+			_, err = store.CompleteMultipartUpload(bucket, object, uploadID, parts)
+			if test.Err != nil {
+				store.AbortMultipartUpload(bucket, object, uploadID)
+				test.Err.Expect(t, err)
+				continue
+			}
+			if err != nil {
+				store.AbortMultipartUpload(bucket, object, uploadID)
+				t.Fatalf("Test %d: Failed to complete multipart upload of '%s/%s': %s", i, bucket, object, err)
+			}
+			if err = verifyObject(store, bucket, object, payload, 0, size, s3.GetOptions{}); err != nil {
+				t.Errorf("Test %d: Failed to verify object '%s/%s': %s", i, bucket, object, err)
+			}
+			s3.RemoveObject(bucket, object, store.RemoveObject, t)
+		}
+	})
+}
+
+func TestPartNumberLimits(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireLarge(t, largeParts)
+	targets.Run(t, func(t *testing.T, config s3.Config) {
+		store := config.NewStore(t, s3.StoreHTTP)
+		bucket := s3.BucketName("test-part-number-limits")
+		config.MakeTestBucket(t, store, bucket)
+
+		object, data := s3.ObjectName("object"), "Hello World"
+		uploadID, err := store.NewMultipartUpload(bucket, object, s3.PutOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create multipart upload for '%s/%s': %s", bucket, object, err)
+		}
+		defer store.AbortMultipartUpload(bucket, object, uploadID)
+
+		for _, partNumber := range []int{0, s3.MaxParts + 1} {
+			_, err = store.PutObjectPart(bucket, object, uploadID, partNumber, strings.NewReader(data), int64(len(data)), nil)
+			s3.ErrInvalidArgument.Expect(t, err)
+		}
+
+		part, err := store.PutObjectPart(bucket, object, uploadID, s3.MaxParts, strings.NewReader(data), int64(len(data)), nil)
+		if err != nil {
+			t.Fatalf("Failed to upload part %d of '%s/%s': %s", s3.MaxParts, bucket, object, err)
+		}
+		_, err = store.CompleteMultipartUpload(bucket, object, uploadID, []s3.Part{{PartNumber: 1, ETag: part.ETag}})
+		s3.ErrInvalidPart.Expect(t, err)
+		_, err = store.CompleteMultipartUpload(bucket, object, uploadID, []s3.Part{{PartNumber: s3.MaxParts, ETag: strings.Repeat("0", 32)}})
+		s3.ErrInvalidPart.Expect(t, err)
+
+		if _, err = store.CompleteMultipartUpload(bucket, object, uploadID, []s3.Part{part}); err != nil {
+			t.Fatalf("Failed to complete multipart upload of '%s/%s': %s", bucket, object, err)
+		}
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
+		if info, err := store.StatObject(bucket, object, s3.GetOptions{}); err != nil || info.Size != int64(len(data)) {
+			t.Fatalf("Object '%s/%s' has not been created correctly: size=%d err=%v", bucket, object, info.Size, err)
+		}
+	})
+}
+
+func TestPutSizeLimit(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireLarge(t, largePut)
+	targets.Run(t, func(t *testing.T, config s3.Config) {
+		store := config.NewStore(t, s3.StoreHTTP)
+		bucket := s3.BucketName("test-put-size-limit")
+		config.MakeTestBucket(t, store, bucket)
+
+		// The payload is generated while it is sent. Since its
+		// reader is seekable, the request is signed without
+		// buffering the payload - regardless of the signature.
+		object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), s3.MaxPartSize+1)
+		_, err := store.PutObject(bucket, object, payload.Reader(), payload.Size(), s3.PutOptions{})
+		s3.ErrEntityTooLarge.Expect(t, err)
+
+		uploadID, err := store.NewMultipartUpload(bucket, object, s3.PutOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create multipart upload for '%s/%s': %s", bucket, object, err)
+		}
+		_, err = store.PutObjectPart(bucket, object, uploadID, 1, payload.Reader(), payload.Size(), nil)
+		store.AbortMultipartUpload(bucket, object, uploadID)
+		s3.ErrEntityTooLarge.Expect(t, err)
+
+		if _, err = store.PutObject(bucket, object, payload.Reader(), s3.MaxPartSize, s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
+		}
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
+		if info, err := store.StatObject(bucket, object, s3.GetOptions{}); err != nil || info.Size != s3.MaxPartSize {
+			t.Fatalf("Object '%s/%s' has not been created correctly: size=%d err=%v", bucket, object, info.Size, err)
+		}
+	})
+}
+
+func TestObjectSizeLimit(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireLarge(t, largeObject)
+	targets.Run(t, func(t *testing.T, config s3.Config) {
+		store := config.NewStore(t, s3.StoreHTTP)
+		bucket := s3.BucketName("test-object-size-limit")
+		config.MakeTestBucket(t, store, bucket)
+
+		source, payload := s3.ObjectName("source"), s3.NewPayload(s3.Rand(t), s3.MaxPartSize)
+		if _, err := store.PutObject(bucket, source, payload.Reader(), payload.Size(), s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to upload object '%s/%s': %s", bucket, source, err)
+		}
+		defer s3.RemoveObject(bucket, source, store.RemoveObject, t)
+
+		// The object consists of server-side copies of the source object.
+		// Hence, the client uploads only the source object.
+		for i, size := range []int64{s3.MaxObjectSize, s3.MaxObjectSize + 1} {
+			object := s3.ObjectName("object")
+			uploadID, err := store.NewMultipartUpload(bucket, object, s3.PutOptions{})
+			if err != nil {
+				t.Fatalf("Test %d: Failed to create multipart upload for '%s/%s': %s", i, bucket, object, err)
+			}
+
+			var parts []s3.Part
+			for offset := int64(0); offset < size; offset += s3.MaxPartSize {
+				partSize := size - offset
+				if partSize > s3.MaxPartSize {
+					partSize = s3.MaxPartSize
+				}
+				part, err := copyObjectPart(config, bucket, object, uploadID, len(parts)+1, source, 0, partSize)
+				if err != nil {
+					store.AbortMultipartUpload(bucket, object, uploadID)
+					t.Fatalf("Test %d: Failed to copy part %d of '%s/%s': %s", i, len(parts)+1, bucket, object, err)
+				}
+				parts = append(parts, part)
+			}
+
+			_, err = store.CompleteMultipartUpload(bucket, object, uploadID, parts)
+			if size > s3.MaxObjectSize {
+				store.AbortMultipartUpload(bucket, object, uploadID)
+				s3.ErrEntityTooLarge.Expect(t, err)
+				continue
+			}
+			if err != nil {
+				store.AbortMultipartUpload(bucket, object, uploadID)
+				t.Fatalf("Test %d: Failed to complete multipart upload of '%s/%s': %s", i, bucket, object, err)
+			}
+			if info, err := store.StatObject(bucket, object, s3.GetOptions{}); err != nil || info.Size != size {
+				t.Errorf("Test %d: Object '%s/%s' has not been created correctly: size=%d err=%v", i, bucket, object, info.Size, err)
+			}
+			s3.RemoveObject(bucket, object, store.RemoveObject, t)
+		}
+	})
+}
+
+// copyObjectPart uploads size bytes of the source object starting
+// at offset as part of the multipart upload using a server-side copy.
+func copyObjectPart(config s3.Config, bucket, object, uploadID string, partNumber int, source string, offset, size int64) (s3.Part, error) {
+	resp, err := config.Do(s3.Request{
+		Method: http.MethodPut,
+		Bucket: bucket,
+		Object: object,
+		Query:  url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}},
+		Header: http.Header{
+			"X-Amz-Copy-Source":       {"/" + bucket + "/" + source},
+			"X-Amz-Copy-Source-Range": {"bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+size-1, 10)},
+		},
+	})
+	if err != nil {
+		return s3.Part{}, err
+	}
+	defer resp.Body.Close()
+
+	// S3 may respond with 200 OK and an error response body
+	// if a long-running copy fails.
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return s3.Part{}, err
+	}
+	var root struct{ XMLName xml.Name }
+	if err = xml.Unmarshal(body, &root); err != nil {
+		return s3.Part{}, err
+	}
+	if root.XMLName.Local == "Error" {
+		errResp := &s3.ErrorResponse{StatusCode: resp.StatusCode}
+		if err = xml.Unmarshal(body, errResp); err != nil {
+			return s3.Part{}, err
+		}
+		return s3.Part{}, errResp
+	}
+	var result struct {
+		XMLName xml.Name `xml:"CopyPartResult"`
+		ETag    string   `xml:"ETag"`
+	}
+	if err = xml.Unmarshal(body, &result); err != nil {
+		return s3.Part{}, err
+	}
+	if result.ETag == "" {
+		return s3.Part{}, errors.New("Failed to copy part: the response contains no ETag")
+	}
+	return s3.Part{PartNumber: partNumber, ETag: strings.Trim(result.ETag, `"`)}, nil
+}
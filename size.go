@@ -0,0 +1,166 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sizeUnits maps the lowercase SI and IEC unit
+// suffixes to their number of bytes.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// binarySizeUnits maps the lowercase unit suffixes to their
+// number of bytes like sizeUnits but treats the SI suffixes
+// as powers of 1024. See: sizeValue
+var binarySizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1 << 10,
+	"mb":  1 << 20,
+	"gb":  1 << 30,
+	"tb":  1 << 40,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a size in bytes from s. A size is a sum or
+// difference of numbers with an optional SI (kB, MB, GB, TB)
+// or IEC (KiB, MiB, GiB, TiB) unit suffix - e.g. '64KiB+1',
+// '5MiB-1' or '1.5GB'. Units are case-insensitive. Fractional
+// numbers are allowed as long as the size is a whole number
+// of bytes.
+func ParseSize(s string) (int64, error) { return parseSize(s, sizeUnits) }
+
+// parseSize parses a size in bytes from s using
+// the given unit suffixes. See: ParseSize
+func parseSize(s string, units map[string]int64) (int64, error) {
+	expr := strings.Replace(s, " ", "", -1)
+	if expr == "" {
+		return 0, errors.New("Invalid size: size is empty")
+	}
+
+	var size big.Rat
+	for op := byte('+'); ; {
+		term, next := expr, ""
+		if i := strings.IndexAny(expr, "+-"); i >= 0 {
+			term, next = expr[:i], expr[i:]
+		}
+		v, err := parseSizeTerm(term, units)
+		if err != nil {
+			return 0, errors.New("Invalid size '" + s + "': " + err.Error())
+		}
+		if op == '+' {
+			size.Add(&size, v)
+		} else {
+			size.Sub(&size, v)
+		}
+		if next == "" {
+			break
+		}
+		op, expr = next[0], next[1:]
+	}
+
+	if !size.IsInt() {
+		return 0, errors.New("Invalid size '" + s + "': not a whole number of bytes")
+	}
+	if size.Sign() < 0 {
+		return 0, errors.New("Invalid size '" + s + "': size is negative")
+	}
+	if !size.Num().IsInt64() {
+		return 0, errors.New("Invalid size '" + s + "': size is too large")
+	}
+	return size.Num().Int64(), nil
+}
+
+// parseSizeTerm parses a number with an optional unit suffix.
+func parseSizeTerm(term string, units map[string]int64) (*big.Rat, error) {
+	i := strings.IndexFunc(term, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(term)
+	}
+	number, unit := term[:i], term[i:]
+	if number == "" {
+		return nil, errors.New("missing number")
+	}
+	v, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return nil, errors.New("invalid number '" + number + "'")
+	}
+	scale, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return nil, errors.New("unknown unit '" + unit + "'")
+	}
+	return v.Mul(v, new(big.Rat).SetInt64(scale)), nil
+}
+
+// ParseSizes parses a comma-separated list of sizes
+// from s - e.g. '0,1,64KiB-1,64KiB,64KiB+1,5MiB'.
+// See: ParseSize
+func ParseSizes(s string) ([]int64, error) {
+	var sizes []int64
+	for _, field := range strings.Split(s, ",") {
+		size, err := ParseSize(field)
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// RunSizes runs f as subtest of t for every object size of the
+// config. The name of each subtest is the size in bytes. If the
+// config does not specify any Sizes, RunSizes runs f with the
+// given default size - usually Size or MultipartSize - without
+// creating a subtest.
+func (c *Config) RunSizes(t *testing.T, size int64, f func(*testing.T, int64)) {
+	if len(c.Sizes) == 0 {
+		f(t, size)
+		return
+	}
+	for _, size := range c.Sizes {
+		size := size
+		t.Run(strconv.FormatInt(size, 10), func(t *testing.T) { f(t, size) })
+	}
+}
+
+type sizesValue []int64
+
+func (sv *sizesValue) Set(s string) error {
+	sizes, err := ParseSizes(s)
+	if err != nil {
+		return err
+	}
+	*sv = sizes
+	return nil
+}
+
+func (sv *sizesValue) Get() interface{} { return []int64(*sv) }
+
+func (sv *sizesValue) String() string {
+	sizes := make([]string, 0, len(*sv))
+	for _, size := range *sv {
+		sizes = append(sizes, strconv.FormatInt(size, 10))
+	}
+	return strings.Join(sizes, ",")
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+var parseSizeTests = []struct {
+	Size       string
+	Value      int64
+	ShouldFail bool
+}{
+	{Size: "0", Value: 0},                               // 0
+	{Size: "1", Value: 1},                               // 1
+	{Size: "1B", Value: 1},                              // 2
+	{Size: "64KiB", Value: 64 * 1024},                   // 3
+	{Size: "64KiB-1", Value: 64*1024 - 1},               // 4
+	{Size: "64kib+1", Value: 64*1024 + 1},               // 5
+	{Size: "5MiB+1", Value: 5<<20 + 1},                  // 6
+	{Size: "1kB", Value: 1000},                          // 7
+	{Size: "1.5GB", Value: 1500 * 1000 * 1000},          // 8
+	{Size: "1.5GiB", Value: 3 << 29},                    // 9
+	{Size: "5TiB", Value: 5 << 40},                      // 10
+	{Size: "1MiB + 1KiB - 1", Value: 1<<20 + 1<<10 - 1}, // 11
+	{Size: "0.5B", ShouldFail: true},                    // 12
+	{Size: "1-2", ShouldFail: true},                     // 13
+	{Size: "-1", ShouldFail: true},                      // 14
+	{Size: "1XB", ShouldFail: true},                     // 15
+	{Size: "", ShouldFail: true},                        // 16
+	{Size: "1+", ShouldFail: true},                      // 17
+	{Size: "1.2.3", ShouldFail: true},                   // 18
+	{Size: "1e3", ShouldFail: true},                     // 19
+	{Size: "10000000TiB", ShouldFail: true},             // 20
+	{Size: "MiB", ShouldFail: true},                     // 21
+}
+
+func TestParseSize(t *testing.T) {
+	for i, test := range parseSizeTests {
+		size, err := s3.ParseSize(test.Size)
+		if err != nil && !test.ShouldFail {
+			t.Fatalf("Test %d: Failed to parse size '%s': %v", i, test.Size, err)
+		}
+		if err == nil && test.ShouldFail {
+			t.Fatalf("Test %d: Parsing size '%s' should fail but succeeded", i, test.Size)
+		}
+		if size != test.Value {
+			t.Fatalf("Test %d: Size mismatch: got %d - want %d", i, size, test.Value)
+		}
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	sizes, err := s3.ParseSizes("0,1,64KiB-1,64KiB,64KiB+1,5MiB,5MiB+1,65MiB")
+	if err != nil {
+		t.Fatalf("Failed to parse sizes: %v", err)
+	}
+	want := []int64{0, 1, 64<<10 - 1, 64 << 10, 64<<10 + 1, 5 << 20, 5<<20 + 1, 65 << 20}
+	if len(sizes) != len(want) {
+		t.Fatalf("Sizes mismatch: got %v - want %v", sizes, want)
+	}
+	for i := range sizes {
+		if sizes[i] != want[i] {
+			t.Fatalf("Sizes mismatch: got %v - want %v", sizes, want)
+		}
+	}
+	if _, err = s3.ParseSizes("1,,2"); err == nil {
+		t.Fatal("Parsing sizes with an empty size should fail but succeeded")
+	}
+}
@@ -2,10 +2,8 @@ package s3_test
 
 import (
 	"bytes"
-	"crypto/tls"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"testing"
 
 	"github.com/aead/s3"
@@ -13,35 +11,53 @@ import (
 	"github.com/minio/minio-go/pkg/encrypt"
 )
 
-func BenchmarkEncryptedPut(b *testing.B) {
-	if err := s3.Parse(); err != nil {
-		b.Fatal(err)
+// encryptedBenchmarks are the server-side-encryptions
+// the SSE benchmarks run with - one sub-benchmark each.
+var encryptedBenchmarks = []s3.SSEType{s3.SSEC, s3.SSEKMS}
+
+// newBenchmarkSSE returns a new minio-go server-side-encryption of
+// the given type. The SSE-C key is derived from the password and
+// the salt. SSE-KMS uses the KMS master key keyID.
+func newBenchmarkSSE(b *testing.B, sseType s3.SSEType, password, keyID, salt string) encrypt.ServerSide {
+	if sseType != s3.SSEKMS {
+		return encrypt.DefaultPBKDF([]byte(password), []byte(salt))
 	}
-	if s3.NoTLS {
-		b.Skip("Skipping benchmark because of -disableTLS flag")
+	encryption, err := encrypt.NewSSEKMS(keyID, nil)
+	if err != nil {
+		b.Fatalf("Failed to create SSE-KMS encryption: %s", err)
 	}
+	return encryption
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
+func BenchmarkEncryptedPut(b *testing.B) {
+	targets, err := s3.Parse()
 	if err != nil {
-		b.Fatalf("Failed to create client: %v", err)
+		b.Fatal(err)
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
+	targets.RunBenchmark(b, func(b *testing.B, config s3.Config) {
+		for _, sseType := range encryptedBenchmarks {
+			b.Run(string(sseType), func(b *testing.B) { benchmarkEncryptedPut(b, config, sseType) })
+		}
 	})
+}
 
-	bucket := s3.BucketName("bench-encrypted-put")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		b.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(b)
+func benchmarkEncryptedPut(b *testing.B, config s3.Config, sseType s3.SSEType) {
+	config.RequireTLS(b)
+	if feature := (&s3.SSE{Type: sseType}).Feature(); !config.Features.Enabled(feature) {
+		b.Skipf("Skipping benchmark because %s is disabled", feature)
 	}
 
-	object, data, password := "object-1", make([]byte, s3.Size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+object))
+	client := config.NewClient(b)
+
+	bucket := s3.BucketName("bench-encrypted-put")
+	config.MakeTestBucket(b, client, bucket)
+
+	object, data, password := s3.ObjectName("object"), randomData(b, config.Size), "my-password"
+	encryption := newBenchmarkSSE(b, sseType, password, config.KMSKeyID, bucket+object)
 	options := minio.PutObjectOptions{
 		ServerSideEncryption: encryption,
 	}
-	if _, err = client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+	if _, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
 		b.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
 	}
 	defer s3.RemoveObject(bucket, object, client.RemoveObject, b)
@@ -49,41 +65,41 @@ func BenchmarkEncryptedPut(b *testing.B) {
 	b.ResetTimer()
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		if _, err = client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+		if _, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
 			b.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
 		}
 	}
 }
 
 func BenchmarkEncryptedGet(b *testing.B) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		b.Fatal(err)
 	}
-	if s3.NoTLS {
-		b.Skip("Skipping benchmark because of -disableTLS flag")
-	}
+	targets.RunBenchmark(b, func(b *testing.B, config s3.Config) {
+		for _, sseType := range encryptedBenchmarks {
+			b.Run(string(sseType), func(b *testing.B) { benchmarkEncryptedGet(b, config, sseType) })
+		}
+	})
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		b.Fatalf("Failed to create client: %v", err)
+func benchmarkEncryptedGet(b *testing.B, config s3.Config, sseType s3.SSEType) {
+	config.RequireTLS(b)
+	if feature := (&s3.SSE{Type: sseType}).Feature(); !config.Features.Enabled(feature) {
+		b.Skipf("Skipping benchmark because %s is disabled", feature)
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
+
+	client := config.NewClient(b)
 
 	bucket := s3.BucketName("bench-encrypted-get")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		b.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(b)
-	}
+	config.MakeTestBucket(b, client, bucket)
 
-	object, data, password := "object-1", make([]byte, s3.Size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+object))
+	object, data, password := s3.ObjectName("object"), randomData(b, config.Size), "my-password"
+	encryption := newBenchmarkSSE(b, sseType, password, config.KMSKeyID, bucket+object)
 	options := minio.PutObjectOptions{
 		ServerSideEncryption: encryption,
 	}
-	if _, err = client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+	if _, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
 		b.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
 	}
 	defer s3.RemoveObject(bucket, object, client.RemoveObject, b)
@@ -102,39 +118,46 @@ func BenchmarkEncryptedGet(b *testing.B) {
 }
 
 func BenchmarkEncryptedCopy(b *testing.B) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		b.Fatal(err)
 	}
-	if s3.NoTLS {
-		b.Skip("Skipping benchmark because of -disableTLS flag")
-	}
+	targets.RunBenchmark(b, func(b *testing.B, config s3.Config) {
+		for _, sseType := range encryptedBenchmarks {
+			b.Run(string(sseType), func(b *testing.B) { benchmarkEncryptedCopy(b, config, sseType) })
+		}
+	})
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		b.Fatalf("Failed to create client: %v", err)
+func benchmarkEncryptedCopy(b *testing.B, config s3.Config, sseType s3.SSEType) {
+	config.RequireTLS(b)
+	if feature := (&s3.SSE{Type: sseType}).Feature(); !config.Features.Enabled(feature) {
+		b.Skipf("Skipping benchmark because %s is disabled", feature)
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
+
+	client := config.NewClient(b)
 
 	bucket := s3.BucketName("bench-encrypted-copy")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		b.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(b)
-	}
+	config.MakeTestBucket(b, client, bucket)
 
-	srcObject, dstObject, data, password := "object-1-src", "object-1-dst", make([]byte, s3.Size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+srcObject+dstObject))
+	srcObject, dstObject, data, password := s3.ObjectName("src-object"), s3.ObjectName("dst-object"), randomData(b, config.Size), "my-password"
+	encryption := newBenchmarkSSE(b, sseType, password, config.KMSKeyID, bucket+srcObject+dstObject)
 	options := minio.PutObjectOptions{
 		ServerSideEncryption: encryption,
 	}
-	if _, err = client.PutObject(bucket, srcObject, bytes.NewReader(data), int64(len(data)), options); err != nil {
+	if _, err := client.PutObject(bucket, srcObject, bytes.NewReader(data), int64(len(data)), options); err != nil {
 		b.Fatalf("Failed to upload object '%s/%s': %s", bucket, srcObject, err)
 	}
 	defer s3.RemoveObject(bucket, srcObject, client.RemoveObject, b)
 
-	src := minio.NewSourceInfo(bucket, srcObject, encryption)
+	srcEncryption := encryption
+	if sseType != s3.SSEC {
+		// Only SSE-C requires headers to decrypt the source and
+		// minio-go would send the SSE-KMS headers of the source
+		// as headers of the destination.
+		srcEncryption = nil
+	}
+	src := minio.NewSourceInfo(bucket, srcObject, srcEncryption)
 	dst, err := minio.NewDestinationInfo(bucket, dstObject, encryption, nil)
 	if err != nil {
 		b.Fatalf("Failed to create object destination '%s/%s': %s", bucket, dstObject, err)
@@ -5,92 +5,136 @@
 package s3_test
 
 import (
-	"bytes"
-	"crypto/tls"
-	"io/ioutil"
-	"net/http"
 	"testing"
 
 	"github.com/aead/s3"
-	"github.com/minio/minio-go/pkg/encrypt"
-
-	minio "github.com/minio/minio-go"
 )
 
 func TestCustomerEncryptedCopy(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) { testCustomerEncryptedCopy(t, config, store, size) })
+	})
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
+func testCustomerEncryptedCopy(t *testing.T, config s3.Config, store s3.Store, size int64) {
+	config.RequireTLS(t)
+	if !config.Features.Enabled(s3.FeatureSSEC) {
+		t.Skip("Skipping test because SSE-C is disabled")
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
+
 	bucket := s3.BucketName("test-customer-encrypted-copy")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+	config.MakeTestBucket(t, store, bucket)
 
 	// 1. Test SSE-C unencrypted -> encrypted copy
-	srcObject, dstObject, data, password := "src-object-1", "dst-object-1", make([]byte, s3.Size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+dstObject))
-	src := minio.NewSourceInfo(bucket, srcObject, nil)
-	dst, err := minio.NewDestinationInfo(bucket, dstObject, encryption, nil)
-	if err != nil {
-		t.Fatalf("Failed to create destination: %s", err)
-	}
-
-	if _, err = client.PutObject(bucket, srcObject, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{}); err != nil {
+	srcObject, dstObject, payload, password := s3.ObjectName("src-object"), s3.ObjectName("dst-object"), s3.NewPayload(s3.Rand(t), size), "my-password"
+	encryption := s3.NewSSECWithPassword([]byte(password), []byte(bucket+dstObject))
+	if _, err := store.PutObject(bucket, srcObject, payload.Reader(), payload.Size(), s3.PutOptions{}); err != nil {
 		t.Fatalf("Failed to create object '%s/%s': %s", bucket, srcObject, err)
 	}
-	defer s3.RemoveObject(bucket, srcObject, client.RemoveObject, t)
-	if err = client.CopyObject(dst, src); err != nil {
+	defer s3.RemoveObject(bucket, srcObject, store.RemoveObject, t)
+	if err := store.CopyObject(bucket, dstObject, bucket, srcObject, s3.CopyOptions{SSE: encryption}); err != nil {
 		t.Fatalf("Failed to copy %s/%s to %s/%s: %s", bucket, srcObject, bucket, dstObject, err)
 	}
-	defer s3.RemoveObject(bucket, dstObject, client.RemoveObject, t)
+	defer s3.RemoveObject(bucket, dstObject, store.RemoveObject, t)
+	if err := verifyObject(store, bucket, dstObject, payload, 0, payload.Size(), s3.GetOptions{SSE: encryption}); err != nil {
+		t.Fatalf("Failed to verify object '%s/%s': %s", bucket, dstObject, err)
+	}
 
 	// 2. Test SSE-C encrypted -> encrypted copy
-	srcObject, dstObject, password = dstObject, "dst-object-2", "my-password"
-	src = minio.NewSourceInfo(bucket, srcObject, encryption)
-	encryption = encrypt.DefaultPBKDF([]byte(password), []byte(bucket+dstObject))
-	dst, err = minio.NewDestinationInfo(bucket, dstObject, encryption, nil)
-	if err != nil {
-		t.Fatalf("Failed to create destination: %s", err)
+	srcObject, dstObject, password = dstObject, s3.ObjectName("dst-object"), "my-password"
+	srcEncryption := encryption
+	encryption = s3.NewSSECWithPassword([]byte(password), []byte(bucket+dstObject))
+	if err := store.CopyObject(bucket, dstObject, bucket, srcObject, s3.CopyOptions{SSE: encryption, SourceSSE: srcEncryption}); err != nil {
+		t.Fatalf("Failed to copy %s/%s to %s/%s: %s", bucket, srcObject, bucket, dstObject, err)
+	}
+	defer s3.RemoveObject(bucket, dstObject, store.RemoveObject, t)
+	if err := verifyObject(store, bucket, dstObject, payload, 0, payload.Size(), s3.GetOptions{SSE: encryption}); err != nil {
+		t.Fatalf("Failed to verify object '%s/%s': %s", bucket, dstObject, err)
 	}
 
-	if err = client.CopyObject(dst, src); err != nil {
+	// 3. Test SSE-C encrypted -> unencrypted copy
+	srcObject, dstObject = dstObject, s3.ObjectName("dst-object")
+	if err := store.CopyObject(bucket, dstObject, bucket, srcObject, s3.CopyOptions{SourceSSE: encryption}); err != nil {
 		t.Fatalf("Failed to copy %s/%s to %s/%s: %s", bucket, srcObject, bucket, dstObject, err)
 	}
-	defer s3.RemoveObject(bucket, dstObject, client.RemoveObject, t)
+	defer s3.RemoveObject(bucket, dstObject, store.RemoveObject, t)
+	if err := verifyObject(store, bucket, dstObject, payload, 0, payload.Size(), s3.GetOptions{}); err != nil {
+		t.Fatalf("Failed to verify object '%s/%s': %s", bucket, dstObject, err)
+	}
+}
 
-	// 3. Test SSE-C encrypted -> unencrypted copy
-	srcObject, dstObject = dstObject, "dst-object-3"
-	src = minio.NewSourceInfo(bucket, srcObject, encryption)
-	dst, err = minio.NewDestinationInfo(bucket, dstObject, nil, nil)
+var kmsEncryptedCopyTests = []struct {
+	Source, Destination s3.SSEType        // An empty type means no server-side-encryption.
+	Context             map[string]string // The SSE-KMS context of the destination.
+}{
+	{Source: "", Destination: s3.SSEKMS},                                                       // 0
+	{Source: s3.SSEKMS, Destination: s3.SSEKMS},                                                // 1
+	{Source: s3.SSEKMS, Destination: s3.SSEKMS, Context: map[string]string{"copy": "sse-kms"}}, // 2
+	{Source: s3.SSEKMS, Destination: ""},                                                       // 3
+	{Source: s3.SSES3, Destination: s3.SSEKMS},                                                 // 4
+	{Source: s3.SSEKMS, Destination: s3.SSES3},                                                 // 5
+	{Source: s3.SSEC, Destination: s3.SSEKMS},                                                  // 6
+	{Source: s3.SSEKMS, Destination: s3.SSEC},                                                  // 7
+}
+
+func TestKMSEncryptedCopy(t *testing.T) {
+	targets, err := s3.Parse()
 	if err != nil {
-		t.Fatalf("Failed to create destination: %s", err)
+		t.Fatal(err)
 	}
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) { testKMSEncryptedCopy(t, config, store, size) })
+	})
+}
 
-	if err = client.CopyObject(dst, src); err != nil {
-		t.Fatalf("Failed to copy %s/%s to %s/%s: %s", bucket, srcObject, bucket, dstObject, err)
+func testKMSEncryptedCopy(t *testing.T, config s3.Config, store s3.Store, size int64) {
+	config.RequireTLS(t)
+	if !config.Features.Enabled(s3.FeatureSSEKMS) {
+		t.Skip("Skipping test because SSE-KMS is disabled")
+	}
+
+	bucket := s3.BucketName("test-kms-encrypted-copy")
+	config.MakeTestBucket(t, store, bucket)
+
+	for i, test := range kmsEncryptedCopyTests {
+		srcObject, dstObject, payload := s3.ObjectName("src-object"), s3.ObjectName("dst-object"), s3.NewPayload(s3.Rand(t), size)
+		srcEncryption := newSSE(test.Source, "my-password", config.KMSKeyID, nil, bucket, srcObject)
+		dstEncryption := newSSE(test.Destination, "my-password", config.KMSKeyID, test.Context, bucket, dstObject)
+		if (srcEncryption != nil && !config.Features.Enabled(srcEncryption.Feature())) || (dstEncryption != nil && !config.Features.Enabled(dstEncryption.Feature())) {
+			t.Logf("Test %d: Skipping test because %s or %s is disabled", i, test.Source, test.Destination)
+			continue
+		}
+
+		if _, err := store.PutObject(bucket, srcObject, payload.Reader(), payload.Size(), s3.PutOptions{SSE: srcEncryption}); err != nil {
+			t.Fatalf("Test %d: Failed to create object '%s/%s': %s", i, bucket, srcObject, err)
+		}
+		defer s3.RemoveObject(bucket, srcObject, store.RemoveObject, t)
+		if err := store.CopyObject(bucket, dstObject, bucket, srcObject, s3.CopyOptions{SSE: dstEncryption, SourceSSE: srcEncryption}); err != nil {
+			t.Fatalf("Test %d: Failed to copy %s/%s to %s/%s: %s", i, bucket, srcObject, bucket, dstObject, err)
+		}
+		defer s3.RemoveObject(bucket, dstObject, store.RemoveObject, t)
+
+		if err := verifyObject(store, bucket, dstObject, payload, 0, payload.Size(), s3.GetOptions{SSE: dstEncryption}); err != nil {
+			t.Errorf("Test %d: Failed to verify object '%s/%s': %s", i, bucket, dstObject, err)
+		}
+		if info, err := store.StatObject(bucket, dstObject, s3.GetOptions{SSE: dstEncryption}); err != nil {
+			t.Errorf("Test %d: Failed to receive object info of '%s/%s': %s", i, bucket, dstObject, err)
+		} else if err = checkKMS(info, dstEncryption); err != nil {
+			t.Errorf("Test %d: Invalid object info of '%s/%s': %s", i, bucket, dstObject, err)
+		}
 	}
-	defer s3.RemoveObject(bucket, dstObject, client.RemoveObject, t)
 }
 
 var customerKeyRotationTests = []struct { // Tests are order-depended!
-	Old, New   encrypt.ServerSide
+	Old, New   *s3.SSE
 	ShouldFail bool
 	ErrMessage string
 }{
-	{Old: encrypt.DefaultPBKDF([]byte("my-passowrd"), []byte("my-salt")), New: mustNewSSEC(make([]byte, 32)), ShouldFail: false, ErrMessage: ""},                                                                  // 0
+	{Old: s3.NewSSECWithPassword([]byte("my-passowrd"), []byte("my-salt")), New: mustNewSSEC(make([]byte, 32)), ShouldFail: false, ErrMessage: ""},                                                                // 0
 	{Old: mustNewSSEC(make([]byte, 32)), New: mustNewSSEC(make([]byte, 32)), ShouldFail: false, ErrMessage: ""},                                                                                                   // 1 Equal keys
 	{Old: mustNewSSEC(make([]byte, 32)), New: nil, ShouldFail: false, ErrMessage: ""},                                                                                                                             // 2 Server-Side decrypt
 	{Old: nil, New: mustNewSSEC([]byte("32-byte SSE-C secret encryption.")), ShouldFail: false, ErrMessage: ""},                                                                                                   // 3 Server-Side encrypt
@@ -99,8 +143,8 @@ var customerKeyRotationTests = []struct { // Tests are order-depended!
 	{Old: mustNewSSEC(make([]byte, 32)), New: mustNewSSEC(make([]byte, 32)), ShouldFail: true, ErrMessage: "The provided encryption parameters did not match the ones used originally."},                          // 6 Wrong source key- but src key == dst key != nil See: https://github.com/minio/minio/issues/5625
 }
 
-func mustNewSSEC(key []byte) encrypt.ServerSide {
-	sse, err := encrypt.NewSSEC(key)
+func mustNewSSEC(key []byte) *s3.SSE {
+	sse, err := s3.NewSSEC(key)
 	if err != nil {
 		panic(err)
 	}
@@ -108,44 +152,36 @@ func mustNewSSEC(key []byte) encrypt.ServerSide {
 }
 
 func TestCustomerKeyRotation(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) { testCustomerKeyRotation(t, config, store, size) })
+	})
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
+func testCustomerKeyRotation(t *testing.T, config s3.Config, store s3.Store, size int64) {
+	config.RequireTLS(t)
+	if !config.Features.Enabled(s3.FeatureSSEC) {
+		t.Skip("Skipping test because SSE-C is disabled")
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
+
 	bucket := s3.BucketName("test-customer-key-rotation")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+	config.MakeTestBucket(t, store, bucket)
 
 	if len(customerKeyRotationTests) == 0 {
 		t.Log("warning: no tests to run")
 		return
 	}
-	object, data := "object-1", make([]byte, s3.Size)
-	options := minio.PutObjectOptions{ServerSideEncryption: customerKeyRotationTests[0].Old}
-	if _, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+	object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), size)
+	options := s3.PutOptions{SSE: customerKeyRotationTests[0].Old}
+	if _, err := store.PutObject(bucket, object, payload.Reader(), payload.Size(), options); err != nil {
 		t.Fatalf("Failed to create object '%s/%s': %s", bucket, object, err)
 	}
-	defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
+	defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
 	for i, test := range customerKeyRotationTests {
-		src := minio.NewSourceInfo(bucket, object, test.Old)
-		dst, err := minio.NewDestinationInfo(bucket, object, test.New, nil)
-		if err != nil {
-			t.Fatalf("Test %d: Failed to create destination: %s", i, err)
-		}
-		switch err = client.CopyObject(dst, src); {
+		switch err := store.CopyObject(bucket, object, bucket, object, s3.CopyOptions{SSE: test.New, SourceSSE: test.Old}); {
 		case err != nil && test.ShouldFail:
 			if want, ok := s3.ErrorMessage(err); ok {
 				if want != test.ErrMessage {
@@ -159,16 +195,8 @@ func TestCustomerKeyRotation(t *testing.T) {
 		}
 
 		if !test.ShouldFail {
-			stream, err := client.GetObject(bucket, object, minio.GetObjectOptions{ServerSideEncryption: test.New})
-			if err != nil {
-				t.Fatalf("Failed to open connection to '%s/%s/%s: %s", s3.Endpoint, bucket, object, err)
-			}
-			content, err := ioutil.ReadAll(stream)
-			if err != nil {
-				t.Fatalf("Test %d: Failed to get object %s/%s: %s", i, bucket, object, err)
-			}
-			if !bytes.Equal(content, data) {
-				t.Errorf("Test %d: Download object does not match upload object", i)
+			if err := verifyObject(store, bucket, object, payload, 0, payload.Size(), s3.GetOptions{SSE: test.New}); err != nil {
+				t.Fatalf("Test %d: Failed to verify object '%s/%s': %s", i, bucket, object, err)
 			}
 		}
 	}
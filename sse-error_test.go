@@ -0,0 +1,216 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aead/s3"
+)
+
+// The SSE-C error tests send raw requests since client
+// libraries may reject invalid SSE-C parameters before
+// sending any request.
+
+var (
+	customerKey      = []byte("32-byte SSE-C secret encryption.")
+	wrongCustomerKey = make([]byte, 32)
+)
+
+var customerEncryptionErrorTests = []struct {
+	Encrypted bool   // The object is encrypted with customerKey.
+	Algorithm string // An empty algorithm means no SSE-C headers.
+	Key       []byte
+	KeyMD5    []byte // If nil, the MD5 sum of the Key.
+	Err       s3.APIError
+}{
+	{Encrypted: true, Err: s3.ErrInvalidRequest},                                                                         // 0 No SSE-C key
+	{Encrypted: true, Algorithm: "AES256", Key: wrongCustomerKey, Err: s3.ErrAccessDenied},                               // 1 Wrong key
+	{Encrypted: true, Algorithm: "AES256", Key: customerKey, KeyMD5: make([]byte, md5.Size), Err: s3.ErrInvalidArgument}, // 2 Bad key MD5
+	{Encrypted: true, Algorithm: "AES256", Key: make([]byte, 16), Err: s3.ErrInvalidArgument},                            // 3 128 bit key
+	{Encrypted: true, Algorithm: "AES256", Key: make([]byte, 33), Err: s3.ErrInvalidArgument},                            // 4 264 bit key
+	{Encrypted: true, Algorithm: "AES128", Key: customerKey, Err: s3.ErrInvalidArgument},                                 // 5 Unsupported algorithm
+	{Encrypted: false, Algorithm: "AES256", Key: customerKey, Err: s3.ErrInvalidRequest},                                 // 6 SSE-C headers for a plaintext object
+}
+
+// customerKeyHeader returns the SSE-C request headers for the
+// algorithm, key and key MD5. If keyMD5 is nil, the MD5 sum of
+// the key is used. It returns nil if the algorithm is empty.
+func customerKeyHeader(algorithm string, key, keyMD5 []byte) http.Header {
+	if algorithm == "" {
+		return nil
+	}
+	if keyMD5 == nil {
+		sum := md5.Sum(key)
+		keyMD5 = sum[:]
+	}
+	h := http.Header{}
+	h.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", algorithm)
+	h.Set("X-Amz-Server-Side-Encryption-Customer-Key", base64.StdEncoding.EncodeToString(key))
+	h.Set("X-Amz-Server-Side-Encryption-Customer-Key-MD5", base64.StdEncoding.EncodeToString(keyMD5))
+	return h
+}
+
+// checkNoLeak returns an error if the error response reveals
+// the content or the size of the object data - e.g. as part of
+// the body or by the Content-Length or Content-Range header.
+func checkNoLeak(resp *http.Response, body, data []byte) error {
+	if length := resp.Header.Get("Content-Length"); length == strconv.Itoa(len(data)) {
+		return fmt.Errorf("Response reveals the object size: Content-Length: %s", length)
+	}
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		return fmt.Errorf("Response reveals the object size: Content-Range: %s", contentRange)
+	}
+	const chunkSize = 16
+	for i := 0; i+chunkSize <= len(data); i += chunkSize {
+		if bytes.Contains(body, data[i:i+chunkSize]) {
+			return fmt.Errorf("Response contains the object content at offset %d", i)
+		}
+	}
+	return nil
+}
+
+// checkError returns an error if err is not the S3 error
+// response want. Responses to HEAD requests contain no S3
+// error, so only their status code is checked.
+func checkError(method string, err error, want s3.APIError) error {
+	if err == nil {
+		return fmt.Errorf("%s should fail with '%s' but succeeded", method, want.Code)
+	}
+	respErr, ok := s3.AsResponseError(err)
+	if !ok {
+		return fmt.Errorf("%s should fail with '%s' but failed with a non-S3 error: %v", method, want.Code, err)
+	}
+	if respErr.StatusCode != want.StatusCode {
+		return fmt.Errorf("%s should fail with status '%d %s' but failed with '%d %s': %v", method, want.StatusCode, http.StatusText(want.StatusCode), respErr.StatusCode, http.StatusText(respErr.StatusCode), err)
+	}
+	if method != http.MethodHead && respErr.Code != want.Code {
+		return fmt.Errorf("%s should fail with '%s' but failed with: %v", method, want.Code, err)
+	}
+	return nil
+}
+
+func TestCustomerEncryptionErrors(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testCustomerEncryptionErrors)
+}
+
+func testCustomerEncryptionErrors(t *testing.T, config s3.Config) {
+	config.RequireTLS(t)
+	if !config.Features.Enabled(s3.FeatureSSEC) {
+		t.Skip("Skipping test because SSE-C is disabled")
+	}
+
+	store := config.NewStore(t, s3.StoreHTTP)
+	bucket := s3.BucketName("test-customer-encryption-errors")
+	config.MakeTestBucket(t, store, bucket)
+
+	encryption, err := s3.NewSSEC(customerKey)
+	if err != nil {
+		t.Fatalf("Failed to create SSE-C encryption: %s", err)
+	}
+	encryptedObject, plaintextObject, data := s3.ObjectName("encrypted-object"), s3.ObjectName("plaintext-object"), randomData(t, 32*1024+7)
+	if _, err = store.PutObject(bucket, encryptedObject, bytes.NewReader(data), int64(len(data)), s3.PutOptions{SSE: encryption}); err != nil {
+		t.Fatalf("Failed to upload object '%s/%s': %s", bucket, encryptedObject, err)
+	}
+	defer s3.RemoveObject(bucket, encryptedObject, store.RemoveObject, t)
+	if _, err = store.PutObject(bucket, plaintextObject, bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+		t.Fatalf("Failed to upload object '%s/%s': %s", bucket, plaintextObject, err)
+	}
+	defer s3.RemoveObject(bucket, plaintextObject, store.RemoveObject, t)
+
+	for i, test := range customerEncryptionErrorTests {
+		object := plaintextObject
+		if test.Encrypted {
+			object = encryptedObject
+		}
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			resp, body, err := config.DoRaw(s3.Request{
+				Method: method,
+				Bucket: bucket,
+				Object: object,
+				Header: customerKeyHeader(test.Algorithm, test.Key, test.KeyMD5),
+			})
+			if resp == nil {
+				t.Fatalf("Test %d: Failed to send %s request for '%s/%s': %v", i, method, bucket, object, err)
+			}
+			if err = checkError(method, err, test.Err); err != nil {
+				t.Errorf("Test %d: %v", i, err)
+			}
+			if err = checkNoLeak(resp, body, data); err != nil {
+				t.Errorf("Test %d: %s '%s/%s': %v", i, method, bucket, object, err)
+			}
+		}
+	}
+}
+
+func TestCustomerEncryptionWithoutTLS(t *testing.T) {
+	targets, err := s3.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Run(t, testCustomerEncryptionWithoutTLS)
+}
+
+func testCustomerEncryptionWithoutTLS(t *testing.T, config s3.Config) {
+	if !config.NoTLS {
+		t.Skip("Skipping test because TLS is enabled")
+	}
+	if !config.Features.Enabled(s3.FeatureSSEC) {
+		t.Skip("Skipping test because SSE-C is disabled")
+	}
+
+	store := config.NewStore(t, s3.StoreHTTP)
+	bucket := s3.BucketName("test-customer-encryption-without-tls")
+	config.MakeTestBucket(t, store, bucket)
+
+	// S3 rejects SSE-C requests sent over plain HTTP since
+	// they contain the SSE-C key.
+	object, data := s3.ObjectName("object"), randomData(t, 32*1024+7)
+	_, _, err := config.DoRaw(s3.Request{
+		Method: http.MethodPut,
+		Bucket: bucket,
+		Object: object,
+		Header: customerKeyHeader("AES256", customerKey, nil),
+		Body:   data,
+	})
+	if err = checkError(http.MethodPut, err, s3.ErrInvalidRequest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.StatObject(bucket, object, s3.GetOptions{}); err == nil {
+		t.Fatalf("Object '%s/%s' has been created by a SSE-C request over plain HTTP", bucket, object)
+	}
+
+	if _, err = store.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+		t.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
+	}
+	defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		resp, body, err := config.DoRaw(s3.Request{
+			Method: method,
+			Bucket: bucket,
+			Object: object,
+			Header: customerKeyHeader("AES256", customerKey, nil),
+		})
+		if resp == nil {
+			t.Fatalf("Failed to send %s request for '%s/%s': %v", method, bucket, object, err)
+		}
+		if err = checkError(method, err, s3.ErrInvalidRequest); err != nil {
+			t.Error(err)
+		}
+		if err = checkNoLeak(resp, body, data); err != nil {
+			t.Errorf("%s '%s/%s': %v", method, bucket, object, err)
+		}
+	}
+}
@@ -5,195 +5,193 @@
 package s3_test
 
 import (
-	"bytes"
-	"crypto/tls"
 	"io/ioutil"
-	"net/http"
-	"strconv"
 	"testing"
 
 	"github.com/aead/s3"
-	minio "github.com/minio/minio-go"
-	"github.com/minio/minio-go/pkg/encrypt"
 )
 
 var encryptedGetTests = []struct {
-	Type     encrypt.Type
+	Type     s3.SSEType
 	Password string
 	KeyID    string
-	Context  interface{}
+	Context  map[string]string
 }{
-	{Type: encrypt.S3},
-	{Type: encrypt.SSEC, Password: "my-password"},
+	{Type: s3.SSES3},
+	{Type: s3.SSEC, Password: "my-password"},
+	{Type: s3.SSEKMS},
+	{Type: s3.SSEKMS, Context: map[string]string{"purpose": "s3-test", "type": "sse-kms"}},
+}
+
+// getObject downloads the content of the object.
+func getObject(store s3.Store, bucket, object string, opts s3.GetOptions) ([]byte, error) {
+	body, _, err := store.GetObject(bucket, object, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// verifyObject downloads the object and verifies its content
+// against the length bytes of the payload starting at offset.
+// It does not keep the object content in memory.
+func verifyObject(store s3.Store, bucket, object string, payload s3.Payload, offset, length int64, opts s3.GetOptions) error {
+	body, _, err := store.GetObject(bucket, object, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return payload.VerifyRange(body, offset, length)
 }
 
 func TestEncryptedGet(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	testEncryptedGet(s3.BucketName("test-encrypted-get"), s3.Size, t)
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) {
+			testEncryptedGet(s3.BucketName("test-encrypted-get"), size, false, config, store, t)
+		})
+	})
 }
 
 func TestEncryptedMultipartGet(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
 	if testing.Short() {
 		t.Skip("Skipping test because of -short flag")
 	}
-	testEncryptedGet(s3.BucketName("test-encrypted-multipart-get"), s3.MultipartSize, t)
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.MultipartSize, func(t *testing.T, size int64) {
+			testEncryptedGet(s3.BucketName("test-encrypted-multipart-get"), size, true, config, store, t)
+		})
+	})
 }
 
-var encryptedRangeGetTests = []struct {
-	Start, End int64
-}{
-	{Start: 0, End: s3.Size},           // 0
-	{Start: 0, End: -s3.Size},          // 1
-	{Start: s3.Size - 1, End: 0},       // 2
-	{Start: 0, End: 0},                 // 3
-	{Start: 1, End: s3.Size},           // 4
-	{Start: 0, End: s3.Size / 2},       // 5
-	{Start: s3.Size / 2, End: s3.Size}, // 6
+// encryptedRangeGetTests returns the range tests for
+// an object of the given size. Ranges which cannot be
+// satisfied - e.g. all ranges of an empty object - are
+// omitted.
+func encryptedRangeGetTests(size int64) []struct{ Start, End int64 } {
+	tests := []struct{ Start, End int64 }{
+		{Start: 0, End: size},        // 0
+		{Start: 0, End: -size},       // 1
+		{Start: size - 1, End: 0},    // 2
+		{Start: 0, End: 0},           // 3
+		{Start: 1, End: size},        // 4
+		{Start: 0, End: size / 2},    // 5
+		{Start: size / 2, End: size}, // 6
+	}
+	satisfiable := tests[:0]
+	for _, test := range tests {
+		if 0 <= test.Start && test.Start < size {
+			satisfiable = append(satisfiable, test)
+		}
+	}
+	return satisfiable
 }
 
 func TestEncryptedRangeGet(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	bucket := s3.BucketName("test-encrypted-range-get")
-	testEncryptedRangeGet(bucket, s3.Size, encryptedRangeGetTests, t)
-}
-
-var encryptedMultipartRangeGetTests = []struct {
-	Start, End int64
-}{
-	{Start: 0, End: s3.MultipartSize},                    // 0
-	{Start: 0, End: -s3.MultipartSize},                   // 1
-	{Start: s3.MultipartSize - 1, End: 0},                // 2
-	{Start: 0, End: 0},                                   // 3
-	{Start: 1, End: s3.MultipartSize},                    // 4
-	{Start: 0, End: s3.MultipartSize / 2},                // 5
-	{Start: s3.MultipartSize / 2, End: s3.MultipartSize}, // 6
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) {
+			bucket := s3.BucketName("test-encrypted-range-get")
+			testEncryptedRangeGet(bucket, size, false, encryptedRangeGetTests(size), config, store, t)
+		})
+	})
 }
 
 func TestEncryptedMultipartRangeGet(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
 	if testing.Short() {
 		t.Skip("Skipping test because of -short flag")
 	}
-	bucket := s3.BucketName("test-encrypted-multipart-range-get")
-	testEncryptedRangeGet(bucket, s3.MultipartSize, encryptedRangeGetTests, t)
-}
-
-func testEncryptedRangeGet(bucket string, size int64, tests []struct{ Start, End int64 }, t *testing.T) {
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
-	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.MultipartSize, func(t *testing.T, size int64) {
+			bucket := s3.BucketName("test-encrypted-multipart-range-get")
+			testEncryptedRangeGet(bucket, size, true, encryptedRangeGetTests(size), config, store, t)
+		})
 	})
+}
 
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+func testEncryptedRangeGet(bucket string, size int64, multipart bool, tests []struct{ Start, End int64 }, config s3.Config, store s3.Store, t *testing.T) {
+	config.RequireTLS(t)
+	config.MakeTestBucket(t, store, bucket)
 
-	object, data, password := "object-1", make([]byte, size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+object))
-	options := minio.PutObjectOptions{ServerSideEncryption: encryption}
-	if _, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
-		t.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
-	}
-	defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
-
-	for i, test := range tests {
-		opts := minio.GetObjectOptions{ServerSideEncryption: encryption}
-		opts.SetRange(test.Start, test.End)
-		stream, err := client.GetObject(bucket, object, opts)
-		if err != nil {
-			t.Errorf("Test %d: Failed to open connection to '%s/%s/%s: %s", i, s3.Endpoint, bucket, object, err)
+	for i, sseTest := range encryptedGetTests {
+		object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), size)
+		encryption := newSSE(sseTest.Type, sseTest.Password, kmsKeyID(config, sseTest.KeyID), sseTest.Context, bucket, object)
+		if feature := encryption.Feature(); !config.Features.Enabled(feature) {
+			t.Logf("Test %d: Skipping test because %s is disabled", i, feature)
 			continue
 		}
-		content, err := ioutil.ReadAll(stream)
-		if err != nil {
-			t.Errorf("Test %d: Failed get object '%s/%s': %s", i, bucket, object, err)
-			continue
+		if _, err := putObject(store, bucket, object, payload.Reader(), payload.Size(), multipart, s3.PutOptions{SSE: encryption}); err != nil {
+			t.Fatalf("Test %d: Failed to upload object '%s/%s': %s", i, bucket, object, err)
 		}
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
 
-		start := test.Start
-		if test.Start < 0 {
-			test.Start *= -1
-		}
-		if !bytes.Equal(content, data[start:start+int64(len(content))]) {
-			t.Errorf("Test %d: Download object data does not match upload object data", i)
+		for j, test := range tests {
+			opts := s3.GetOptions{SSE: encryption}
+			if err := opts.SetRange(test.Start, test.End); err != nil {
+				t.Errorf("Test %d/%d: Invalid range: %s", i, j, err)
+				continue
+			}
+
+			var offset, length int64
+			switch {
+			case test.Start == 0 && test.End < 0: // The last -End bytes
+				if offset = size + test.End; offset < 0 {
+					offset = 0
+				}
+				length = size - offset
+			case test.Start > 0 && test.End == 0: // All bytes starting at Start
+				offset, length = test.Start, size-test.Start
+			default:
+				if test.End >= size {
+					test.End = size - 1
+				}
+				offset, length = test.Start, test.End-test.Start+1
+			}
+			if err := verifyObject(store, bucket, object, payload, offset, length, opts); err != nil {
+				t.Errorf("Test %d/%d: Failed to verify object '%s/%s': %s", i, j, bucket, object, err)
+			}
 		}
 	}
 }
 
-func testEncryptedGet(bucket string, size int64, t *testing.T) {
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
-	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+func testEncryptedGet(bucket string, size int64, multipart bool, config s3.Config, store s3.Store, t *testing.T) {
+	config.RequireTLS(t)
+	config.MakeTestBucket(t, store, bucket)
 
 	for i, test := range encryptedGetTests {
-		object, data := "object-"+strconv.Itoa(i), make([]byte, size)
-		var encryption encrypt.ServerSide
-		switch test.Type {
-		default:
-			t.Errorf("Test %d: Unknown SSE type: %s", i, test.Type)
+		object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), size)
+		encryption := newSSE(test.Type, test.Password, kmsKeyID(config, test.KeyID), test.Context, bucket, object)
+		if feature := encryption.Feature(); !config.Features.Enabled(feature) {
+			t.Logf("Test %d: Skipping test because %s is disabled", i, feature)
 			continue
-		case encrypt.S3:
-			encryption = encrypt.NewSSE()
-		case encrypt.SSEC:
-			encryption = encrypt.DefaultPBKDF([]byte(test.Password), []byte(bucket+object))
-		case encrypt.KMS:
-			encryption, err = encrypt.NewSSEKMS(test.KeyID, test.Context)
-			if err != nil {
-				t.Errorf("Test %d: Failed to create KMS server side encryption: %s", i, err)
-				continue
-			}
 		}
-		options := minio.PutObjectOptions{ServerSideEncryption: encryption}
-		n, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options)
-		if err != nil {
+		if _, err := putObject(store, bucket, object, payload.Reader(), payload.Size(), multipart, s3.PutOptions{SSE: encryption}); err != nil {
 			t.Fatalf("Test %d: Failed to upload object '%s/%s': %s", i, bucket, object, err)
 		}
-		defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
-		if n != int64(len(data)) {
-			t.Errorf("Test %d: Failed to complete object - object size: %d , uploaded: %d", i, len(data), n)
-		}
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
 
-		stream, err := client.GetObject(bucket, object, minio.GetObjectOptions{ServerSideEncryption: encryption})
-		if err != nil {
-			t.Errorf("Test %d: Failed to open connection to '%s/%s/%s: %s", i, s3.Endpoint, bucket, object, err)
-			continue
-		}
-		content, err := ioutil.ReadAll(stream)
-		if err != nil {
-			t.Errorf("Test %d: Failed to get object %s/%s: %s", i, bucket, object, err)
-			continue
+		if err := verifyObject(store, bucket, object, payload, 0, payload.Size(), s3.GetOptions{SSE: encryption}); err != nil {
+			t.Errorf("Test %d: Failed to verify object '%s/%s': %s", i, bucket, object, err)
 		}
-		if !bytes.Equal(data, content) {
-			t.Errorf("Test %d: Download object does not match upload object", i)
+		if info, err := store.StatObject(bucket, object, s3.GetOptions{SSE: encryption}); err != nil {
+			t.Errorf("Test %d: Failed to receive object info of '%s/%s': %s", i, bucket, object, err)
+		} else if err = checkKMS(info, encryption); err != nil {
+			t.Errorf("Test %d: Invalid object info of '%s/%s': %s", i, bucket, object, err)
 		}
 	}
 }
@@ -7,130 +7,203 @@ package s3_test
 import (
 	"bytes"
 	"crypto/md5"
-	"crypto/tls"
 	"encoding/hex"
-	"net/http"
-	"strconv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/aead/s3"
-	"github.com/minio/minio-go"
-	"github.com/minio/minio-go/pkg/encrypt"
 )
 
 var encryptedPutTests = []struct {
-	Type     encrypt.Type
+	Type     s3.SSEType
 	Password string
 	KeyID    string
-	Context  interface{}
+	Context  map[string]string
 }{
-	{Type: encrypt.S3},
-	{Type: encrypt.SSEC, Password: "my-password"},
+	{Type: s3.SSES3},
+	{Type: s3.SSEC, Password: "my-password"},
+	{Type: s3.SSEKMS},
+	{Type: s3.SSEKMS, Context: map[string]string{"purpose": "s3-test", "type": "sse-kms"}},
+}
+
+// newSSE returns a new server-side-encryption of the given type
+// or nil if sseType is empty. The SSE-C key is derived from the
+// password and the object path.
+func newSSE(sseType s3.SSEType, password, keyID string, context map[string]string, bucket, object string) *s3.SSE {
+	switch sseType {
+	case "":
+		return nil
+	case s3.SSES3:
+		return s3.NewSSES3()
+	case s3.SSEKMS:
+		return s3.NewSSEKMS(keyID, context)
+	default:
+		return s3.NewSSECWithPassword([]byte(password), []byte(bucket+object))
+	}
+}
+
+// kmsKeyID returns keyID or - if keyID is empty -
+// the KMS master key of the config. See: -kms-key
+func kmsKeyID(config s3.Config, keyID string) string {
+	if keyID == "" {
+		return config.KMSKeyID
+	}
+	return keyID
+}
+
+// checkKMS returns an error if the object info does not report
+// the SSE-KMS encryption and the KMS master key requested by
+// encryption. It does nothing if encryption is not SSE-KMS.
+func checkKMS(info s3.ObjectInfo, encryption *s3.SSE) error {
+	if encryption == nil || encryption.Type != s3.SSEKMS {
+		return nil
+	}
+	if info.ServerSideEncryption != "aws:kms" {
+		return fmt.Errorf("Server-side-encryption mismatch: got '%s' - want 'aws:kms'", info.ServerSideEncryption)
+	}
+	if info.SSEKMSKeyID == "" {
+		return errors.New("No SSE-KMS key ID returned")
+	}
+
+	// S3 may return the ARN of the key - e.g.
+	// 'arn:aws:kms:eu-west-1:123456789012:key/<key-id>'.
+	if encryption.KeyID != "" && !strings.HasSuffix(info.SSEKMSKeyID, encryption.KeyID) {
+		return fmt.Errorf("SSE-KMS key ID mismatch: got '%s' - want '%s'", info.SSEKMSKeyID, encryption.KeyID)
+	}
+	return nil
+}
+
+// checkKMSContext returns an error if the SSE-KMS encryption
+// context of the object info does not contain the context
+// requested by encryption. S3 may add its own entries - e.g.
+// 'aws:s3:arn'.
+func checkKMSContext(info s3.ObjectInfo, encryption *s3.SSE) error {
+	if encryption == nil || encryption.Type != s3.SSEKMS {
+		return nil
+	}
+	for k, v := range encryption.Context {
+		if value, ok := info.SSEKMSContext[k]; !ok || value != v {
+			return fmt.Errorf("SSE-KMS context mismatch: got %v - want %v", info.SSEKMSContext, encryption.Context)
+		}
+	}
+	return nil
+}
+
+// randomData returns size bytes of pseudorandom data
+// derived from the seed of the test run. See: s3.Rand
+func randomData(t testing.TB, size int64) []byte {
+	data := make([]byte, size)
+	s3.Rand(t).Read(data)
+	return data
+}
+
+// multipartPartSize is the part size of multipart uploads. It is
+// the min. part size such that objects of more than 5 MiB - e.g.
+// the '-sizes' boundary 5MiB+1 - are uploaded in multiple parts.
+const multipartPartSize = s3.MinPartSize
+
+// putObject uploads size bytes of data as object - using a
+// multipart upload if multipart is true.
+func putObject(store s3.Store, bucket, object string, data io.Reader, size int64, multipart bool, opts s3.PutOptions) (s3.ObjectInfo, error) {
+	if multipart {
+		return s3.PutMultipartObject(store, bucket, object, data, size, multipartPartSize, opts)
+	}
+	return store.PutObject(bucket, object, data, size, opts)
 }
 
 func TestEncryptedPut(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	testEncryptedPut(s3.BucketName("test-encrypted-put"), s3.Size, t)
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.Size, func(t *testing.T, size int64) {
+			testEncryptedPut(s3.BucketName("test-encrypted-put"), size, false, config, store, t)
+		})
+	})
 }
 
 func TestEncryptedMultipartPut(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
 	if testing.Short() {
 		t.Skip("Skipping test because of -short flag")
 	}
-	testEncryptedPut(s3.BucketName("test-encrypted-multipart-put"), s3.MultipartSize, t)
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		config.RunSizes(t, config.MultipartSize, func(t *testing.T, size int64) {
+			testEncryptedPut(s3.BucketName("test-encrypted-multipart-put"), size, true, config, store, t)
+		})
+	})
 }
 
-func testEncryptedPut(bucket string, size int64, t *testing.T) {
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
-	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+func testEncryptedPut(bucket string, size int64, multipart bool, config s3.Config, store s3.Store, t *testing.T) {
+	config.RequireTLS(t)
+	config.MakeTestBucket(t, store, bucket)
 
 	for i, test := range encryptedPutTests {
-		object, data := "object-"+strconv.Itoa(i), make([]byte, size)
-		var encryption encrypt.ServerSide
-		switch test.Type {
-		default:
-			t.Errorf("Test %d: Unknown SSE type: %s", i, test.Type)
+		object, payload := s3.ObjectName("object"), s3.NewPayload(s3.Rand(t), size)
+		encryption := newSSE(test.Type, test.Password, kmsKeyID(config, test.KeyID), test.Context, bucket, object)
+		if feature := encryption.Feature(); !config.Features.Enabled(feature) {
+			t.Logf("Test %d: Skipping test because %s is disabled", i, feature)
 			continue
-		case encrypt.S3:
-			encryption = encrypt.NewSSE()
-		case encrypt.SSEC:
-			encryption = encrypt.DefaultPBKDF([]byte(test.Password), []byte(bucket+object))
-		case encrypt.KMS:
-			encryption, err = encrypt.NewSSEKMS(test.KeyID, test.Context)
-			if err != nil {
-				t.Errorf("Test %d: Failed to create KMS server side encryption: %s", i, err)
-				continue
-			}
 		}
-		options := minio.PutObjectOptions{ServerSideEncryption: encryption}
-		n, err := client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options)
+		info, err := putObject(store, bucket, object, payload.Reader(), payload.Size(), multipart, s3.PutOptions{SSE: encryption})
 		if err != nil {
 			t.Fatalf("Test %d: Failed to upload object '%s/%s': %s", i, bucket, object, err)
 		}
-		defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
-		if n != int64(len(data)) {
-			t.Errorf("Test %d: Failed to complete object - object size: %d , uploaded: %d", i, len(data), n)
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
+
+		// Only single part uploads return the SSE-KMS context and
+		// minio-go does not expose the response headers of PutObject.
+		if !multipart && store.Name() != s3.StoreMinio {
+			if err = checkKMSContext(info, encryption); err != nil {
+				t.Errorf("Test %d: Invalid object info of '%s/%s': %s", i, bucket, object, err)
+			}
+		}
+
+		info, err = store.StatObject(bucket, object, s3.GetOptions{SSE: encryption})
+		if err != nil {
+			t.Fatalf("Test %d: Failed to receive object info of '%s/%s': %s", i, bucket, object, err)
+		}
+		if info.Size != payload.Size() {
+			t.Errorf("Test %d: Failed to complete object - object size: %d , uploaded: %d", i, payload.Size(), info.Size)
+		}
+		if err = checkKMS(info, encryption); err != nil {
+			t.Errorf("Test %d: Invalid object info of '%s/%s': %s", i, bucket, object, err)
 		}
 	}
 }
 
 func TestEncryptedObjectEtag(t *testing.T) {
-	if err := s3.Parse(); err != nil {
+	targets, err := s3.Parse()
+	if err != nil {
 		t.Fatal(err)
 	}
-	if s3.NoTLS {
-		t.Skip("Skipping test because of -disableTLS flag")
-	}
+	targets.RunStores(t, testEncryptedObjectEtag)
+}
 
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, true)
-	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
+func testEncryptedObjectEtag(t *testing.T, config s3.Config, store s3.Store) {
+	config.RequireTLS(t)
+	if !config.Features.Enabled(s3.FeatureSSEC) {
+		t.Skip("Skipping test because SSE-C is disabled")
 	}
-	client.SetCustomTransport(&http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-	})
 
 	bucket := s3.BucketName("test-encrypted-object-etag")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+	config.MakeTestBucket(t, store, bucket)
 
-	object, data, password := "object-1", make([]byte, s3.Size), "my-password"
-	encryption := encrypt.DefaultPBKDF([]byte(password), []byte(bucket+object))
-	options := minio.PutObjectOptions{
-		ServerSideEncryption: encryption,
-	}
-
-	if _, err = client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+	object, data, password := s3.ObjectName("object"), randomData(t, config.Size), "my-password"
+	encryption := s3.NewSSECWithPassword([]byte(password), []byte(bucket+object))
+	if _, err := store.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), s3.PutOptions{SSE: encryption}); err != nil {
 		t.Fatalf("Failed to upload object '%s/%s': %s", bucket, object, err)
 	}
-	defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
+	defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
 
-	info, err := client.StatObject(bucket, object, minio.StatObjectOptions{
-		GetObjectOptions: minio.GetObjectOptions{
-			ServerSideEncryption: encryption,
-		},
-	})
+	info, err := store.StatObject(bucket, object, s3.GetOptions{SSE: encryption})
 	if err != nil {
 		t.Fatalf("Failed to receive object info of '%s/%s': %s", bucket, object, err)
 	}
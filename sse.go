@@ -0,0 +1,177 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/minio/minio-go/pkg/encrypt"
+	"golang.org/x/crypto/argon2"
+)
+
+// SSEType is the type of a S3 server-side-encryption.
+type SSEType string
+
+const (
+	// SSES3 is server-side-encryption with keys managed by the S3 server.
+	SSES3 SSEType = "SSE-S3"
+	// SSEC is server-side-encryption with customer-provided keys.
+	SSEC SSEType = "SSE-C"
+	// SSEKMS is server-side-encryption with keys managed by a KMS.
+	SSEKMS SSEType = "SSE-KMS"
+)
+
+// SSE describes a server-side-encryption independent of a
+// particular S3 client library. A nil *SSE means that no
+// server-side-encryption is requested.
+type SSE struct {
+	Type SSEType
+
+	// Key is the 256 bit SSE-C customer key.
+	Key []byte
+
+	// KeyID is the ID of the SSE-KMS master key. If empty, the
+	// server uses its default master key.
+	KeyID string
+	// Context is the optional SSE-KMS encryption context.
+	Context map[string]string
+}
+
+// NewSSES3 returns a new SSE-S3 server-side-encryption.
+func NewSSES3() *SSE { return &SSE{Type: SSES3} }
+
+// NewSSEKMS returns a new SSE-KMS server-side-encryption using
+// the KMS master key keyID and the encryption context.
+func NewSSEKMS(keyID string, context map[string]string) *SSE {
+	return &SSE{Type: SSEKMS, KeyID: keyID, Context: context}
+}
+
+// NewSSEC returns a new SSE-C server-side-encryption using
+// the 256 bit customer key.
+func NewSSEC(key []byte) (*SSE, error) {
+	if len(key) != 32 {
+		return nil, errors.New("The SSE-C key must be 256 bits long")
+	}
+	return &SSE{Type: SSEC, Key: append([]byte{}, key...)}, nil
+}
+
+// NewSSECWithPassword returns a new SSE-C server-side-encryption
+// using a customer key derived from the password and salt. It
+// derives the same key as minio-go's encrypt.DefaultPBKDF.
+func NewSSECWithPassword(password, salt []byte) *SSE {
+	return &SSE{Type: SSEC, Key: argon2.IDKey(password, salt, 1, 64*1024, 4, 32)}
+}
+
+// Feature returns the S3 feature required by the
+// server-side-encryption.
+func (s *SSE) Feature() string {
+	switch s.Type {
+	case SSES3:
+		return FeatureSSES3
+	case SSEKMS:
+		return FeatureSSEKMS
+	default:
+		return FeatureSSEC
+	}
+}
+
+// Marshal adds the S3 server-side-encryption headers to h.
+// It does nothing if s is nil.
+func (s *SSE) Marshal(h http.Header) {
+	if s == nil {
+		return
+	}
+	switch s.Type {
+	case SSES3:
+		h.Set("X-Amz-Server-Side-Encryption", "AES256")
+	case SSEKMS:
+		h.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+		if s.KeyID != "" {
+			h.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.KeyID)
+		}
+		if context := s.encodeContext(); context != "" {
+			h.Set("X-Amz-Server-Side-Encryption-Context", context)
+		}
+	case SSEC:
+		key, keyMD5 := s.encodeKey()
+		h.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+		h.Set("X-Amz-Server-Side-Encryption-Customer-Key", key)
+		h.Set("X-Amz-Server-Side-Encryption-Customer-Key-MD5", keyMD5)
+	}
+}
+
+// MarshalCopySource adds the S3 server-side-encryption headers
+// required to decrypt the source object of a copy operation to h.
+// Only SSE-C requires such headers. It does nothing if s is nil.
+func (s *SSE) MarshalCopySource(h http.Header) {
+	if s == nil || s.Type != SSEC {
+		return
+	}
+	key, keyMD5 := s.encodeKey()
+	h.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	h.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key", key)
+	h.Set("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-MD5", keyMD5)
+}
+
+// encodeKey returns the base64-encoded SSE-C key and
+// the base64-encoded MD5 sum of the key.
+func (s *SSE) encodeKey() (key, keyMD5 string) {
+	sum := md5.Sum(s.Key)
+	return base64.StdEncoding.EncodeToString(s.Key), base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// encodeContext returns the base64-encoded JSON representation
+// of the SSE-KMS encryption context or the empty string if no
+// context is set.
+func (s *SSE) encodeContext() string {
+	if len(s.Context) == 0 {
+		return ""
+	}
+	context, _ := json.Marshal(s.Context) // A map[string]string can always be marshaled
+	return base64.StdEncoding.EncodeToString(context)
+}
+
+// decodeContext decodes the base64-encoded JSON representation
+// of a SSE-KMS encryption context. It returns nil if the context
+// is empty or not a valid encoding.
+func decodeContext(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	var context map[string]string
+	if err = json.Unmarshal(data, &context); err != nil {
+		return nil
+	}
+	return context
+}
+
+// minio returns the minio-go representation of the
+// server-side-encryption or nil if s is nil.
+func (s *SSE) minio() (encrypt.ServerSide, error) {
+	if s == nil {
+		return nil, nil
+	}
+	switch s.Type {
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		if len(s.Context) == 0 {
+			return encrypt.NewSSEKMS(s.KeyID, nil)
+		}
+		return encrypt.NewSSEKMS(s.KeyID, s.Context)
+	case SSEC:
+		return encrypt.NewSSEC(s.Key)
+	default:
+		return nil, errors.New("Unknown SSE type '" + string(s.Type) + "'")
+	}
+}
@@ -5,12 +5,9 @@ package s3_test
 
 import (
 	"bytes"
-	"crypto/tls"
-	"net/http"
 	"testing"
 
 	"github.com/aead/s3"
-	minio "github.com/minio/minio-go"
 )
 
 var listObjectStorageClassTests = map[string]string{
@@ -20,39 +17,36 @@ var listObjectStorageClassTests = map[string]string{
 }
 
 func TestListObjectStorageClass(t *testing.T) {
-	if err := s3.Parse(); err != nil {
-		t.Fatal(err)
-	}
-	client, err := minio.New(s3.Endpoint, s3.AccessKey, s3.SecretKey, !s3.NoTLS)
+	targets, err := s3.Parse()
 	if err != nil {
-		t.Fatalf("Failed to create client: %v", err)
+		t.Fatal(err)
 	}
-	if !s3.NoTLS {
-		client.SetCustomTransport(&http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: s3.Insecure},
-		})
+	targets.RunStores(t, testListObjectStorageClass)
+}
+
+func testListObjectStorageClass(t *testing.T, config s3.Config, store s3.Store) {
+	if !config.Features.Enabled(s3.FeatureStorageClass) {
+		t.Skip("Skipping test because storage classes are disabled")
 	}
 	bucket := s3.BucketName("test-list-object-storage-class")
-	if remove, err := s3.MakeBucket(bucket, client.BucketExists, client.MakeBucket, client.RemoveBucket); err != nil {
-		t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
-	} else {
-		defer remove(t)
-	}
+	config.MakeTestBucket(t, store, bucket)
 
-	data, i := make([]byte, s3.Size), 0
+	data, i := randomData(t, config.Size), 0
 	for object, class := range listObjectStorageClassTests {
-		options := minio.PutObjectOptions{StorageClass: class}
-		if _, err = client.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
+		options := s3.PutOptions{StorageClass: class}
+		if _, err := store.PutObject(bucket, object, bytes.NewReader(data), int64(len(data)), options); err != nil {
 			t.Fatalf("Test %d: Failed to upload object '%s/%s': %s", i, bucket, object, err)
 		}
-		defer s3.RemoveObject(bucket, object, client.RemoveObject, t)
+		defer s3.RemoveObject(bucket, object, store.RemoveObject, t)
 		i++
 	}
 
-	doneCh := make(chan struct{})
-	defer close(doneCh)
+	objects, err := store.ListObjects(bucket, "")
+	if err != nil {
+		t.Fatalf("Failed to list objects of bucket '%s': %s", bucket, err)
+	}
 	const DefaultStorageClass = "STANDARD"
-	for objInfo := range client.ListObjects(bucket, "", true, doneCh) {
+	for _, objInfo := range objects {
 		class, ok := listObjectStorageClassTests[objInfo.Key]
 		if !ok {
 			t.Errorf("Object '%s' was not uploaded", objInfo.Key)
@@ -0,0 +1,382 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// NewAWSStore returns a new Store which uses
+// the aws-sdk-go-v2 client to send requests.
+func NewAWSStore(client *awss3.Client) Store { return awsStore{client: client} }
+
+// newAWSClient returns a new aws-sdk-go-v2 client for
+// the endpoint. It uses the addressing style of the config
+// and only computes checksums when required by the S3 API.
+func (c *Config) newAWSClient(t testing.TB) *awss3.Client {
+	return awss3.New(awss3.Options{
+		BaseEndpoint: aws.String(c.url()),
+		Region:       c.region(),
+		UsePathStyle: c.Addressing != AddressingVirtualHost,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			creds, err := c.Credentials()
+			if err != nil {
+				return aws.Credentials{}, err
+			}
+			return aws.Credentials{
+				AccessKeyID:     creds.AccessKey,
+				SecretAccessKey: creds.SecretKey,
+				SessionToken:    creds.SessionToken,
+				Source:          "aead/s3",
+			}, nil
+		}),
+		HTTPClient:                 &http.Client{Transport: c.roundTripper(t)},
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+}
+
+type awsStore struct {
+	client *awss3.Client
+}
+
+func (awsStore) Name() string { return StoreAWS }
+
+func (s awsStore) ListBuckets() ([]BucketInfo, error) {
+	var buckets []BucketInfo
+	for pages := awss3.NewListBucketsPaginator(s.client, &awss3.ListBucketsInput{}); pages.HasMorePages(); {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range page.Buckets {
+			buckets = append(buckets, BucketInfo{
+				Name:         aws.ToString(bucket.Name),
+				CreationDate: aws.ToTime(bucket.CreationDate),
+			})
+		}
+	}
+	return buckets, nil
+}
+
+func (s awsStore) BucketExists(bucket string) (bool, error) {
+	_, err := s.client.HeadBucket(context.Background(), &awss3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchBucket") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s awsStore) MakeBucket(bucket, location string) error {
+	input := &awss3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if location != "" && location != DefaultRegion {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(location),
+		}
+	}
+	_, err := s.client.CreateBucket(context.Background(), input)
+	return err
+}
+
+func (s awsStore) RemoveBucket(bucket string) error {
+	_, err := s.client.DeleteBucket(context.Background(), &awss3.DeleteBucketInput{Bucket: aws.String(bucket)})
+	return err
+}
+
+func (s awsStore) GetBucketLocation(bucket string) (string, error) {
+	output, err := s.client.GetBucketLocation(context.Background(), &awss3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", err
+	}
+	return bucketRegion(string(output.LocationConstraint)), nil
+}
+
+func (s awsStore) GetBucketTagging(bucket string) (map[string]string, error) {
+	output, err := s.client.GetBucketTagging(context.Background(), &awss3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == ErrNoSuchTagSet.Code {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+func (s awsStore) PutObject(bucket, object string, data io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	sse := newAWSSSE(opts.SSE)
+	output, err := s.client.PutObject(context.Background(), &awss3.PutObjectInput{
+		Bucket:                  aws.String(bucket),
+		Key:                     aws.String(object),
+		Body:                    data,
+		ContentLength:           aws.Int64(size),
+		Metadata:                opts.Metadata,
+		StorageClass:            types.StorageClass(opts.StorageClass),
+		ServerSideEncryption:    sse.Type,
+		SSECustomerAlgorithm:    sse.CustomerAlgorithm,
+		SSECustomerKey:          sse.CustomerKey,
+		SSECustomerKeyMD5:       sse.CustomerKeyMD5,
+		SSEKMSKeyId:             sse.KMSKeyID,
+		SSEKMSEncryptionContext: sse.KMSContext,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:                  object,
+		Size:                 size,
+		ETag:                 awsETag(output.ETag),
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		SSECustomerAlgorithm: aws.ToString(output.SSECustomerAlgorithm),
+		SSEKMSKeyID:          aws.ToString(output.SSEKMSKeyId),
+		SSEKMSContext:        decodeContext(aws.ToString(output.SSEKMSEncryptionContext)),
+	}, nil
+}
+
+func (s awsStore) GetObject(bucket, object string, opts GetOptions) (io.ReadCloser, ObjectInfo, error) {
+	sse := newAWSSSE(opts.SSE)
+	input := &awss3.GetObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(object),
+		SSECustomerAlgorithm: sse.CustomerAlgorithm,
+		SSECustomerKey:       sse.CustomerKey,
+		SSECustomerKeyMD5:    sse.CustomerKeyMD5,
+	}
+	if opts.Range != "" {
+		input.Range = aws.String(opts.Range)
+	}
+	output, err := s.client.GetObject(context.Background(), input)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return output.Body, ObjectInfo{
+		Key:                  object,
+		Size:                 aws.ToInt64(output.ContentLength),
+		ETag:                 awsETag(output.ETag),
+		LastModified:         aws.ToTime(output.LastModified),
+		StorageClass:         string(output.StorageClass),
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		SSECustomerAlgorithm: aws.ToString(output.SSECustomerAlgorithm),
+		SSEKMSKeyID:          aws.ToString(output.SSEKMSKeyId),
+	}, nil
+}
+
+func (s awsStore) StatObject(bucket, object string, opts GetOptions) (ObjectInfo, error) {
+	sse := newAWSSSE(opts.SSE)
+	input := &awss3.HeadObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(object),
+		SSECustomerAlgorithm: sse.CustomerAlgorithm,
+		SSECustomerKey:       sse.CustomerKey,
+		SSECustomerKeyMD5:    sse.CustomerKeyMD5,
+	}
+	if opts.Range != "" {
+		input.Range = aws.String(opts.Range)
+	}
+	output, err := s.client.HeadObject(context.Background(), input)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:                  object,
+		Size:                 aws.ToInt64(output.ContentLength),
+		ETag:                 awsETag(output.ETag),
+		LastModified:         aws.ToTime(output.LastModified),
+		StorageClass:         string(output.StorageClass),
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		SSECustomerAlgorithm: aws.ToString(output.SSECustomerAlgorithm),
+		SSEKMSKeyID:          aws.ToString(output.SSEKMSKeyId),
+	}, nil
+}
+
+func (s awsStore) CopyObject(dstBucket, dstObject, srcBucket, srcObject string, opts CopyOptions) error {
+	sse, srcSSE := newAWSSSE(opts.SSE), newAWSSSE(opts.SourceSSE)
+	input := &awss3.CopyObjectInput{
+		Bucket:                         aws.String(dstBucket),
+		Key:                            aws.String(dstObject),
+		CopySource:                     aws.String(encodePath(srcBucket + "/" + srcObject)),
+		StorageClass:                   types.StorageClass(opts.StorageClass),
+		ServerSideEncryption:           sse.Type,
+		SSECustomerAlgorithm:           sse.CustomerAlgorithm,
+		SSECustomerKey:                 sse.CustomerKey,
+		SSECustomerKeyMD5:              sse.CustomerKeyMD5,
+		SSEKMSKeyId:                    sse.KMSKeyID,
+		SSEKMSEncryptionContext:        sse.KMSContext,
+		CopySourceSSECustomerAlgorithm: srcSSE.CustomerAlgorithm,
+		CopySourceSSECustomerKey:       srcSSE.CustomerKey,
+		CopySourceSSECustomerKeyMD5:    srcSSE.CustomerKeyMD5,
+	}
+	if opts.Metadata != nil {
+		input.Metadata, input.MetadataDirective = opts.Metadata, types.MetadataDirectiveReplace
+	}
+	_, err := s.client.CopyObject(context.Background(), input)
+	return err
+}
+
+func (s awsStore) RemoveObject(bucket, object string) error {
+	_, err := s.client.DeleteObject(context.Background(), &awss3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	})
+	return err
+}
+
+func (s awsStore) ListObjects(bucket, prefix string) ([]ObjectInfo, error) {
+	input := &awss3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	var objects []ObjectInfo
+	for pages := awss3.NewListObjectsV2Paginator(s.client, input); pages.HasMorePages(); {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         awsETag(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+				StorageClass: string(object.StorageClass),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s awsStore) NewMultipartUpload(bucket, object string, opts PutOptions) (string, error) {
+	sse := newAWSSSE(opts.SSE)
+	output, err := s.client.CreateMultipartUpload(context.Background(), &awss3.CreateMultipartUploadInput{
+		Bucket:                  aws.String(bucket),
+		Key:                     aws.String(object),
+		Metadata:                opts.Metadata,
+		StorageClass:            types.StorageClass(opts.StorageClass),
+		ServerSideEncryption:    sse.Type,
+		SSECustomerAlgorithm:    sse.CustomerAlgorithm,
+		SSECustomerKey:          sse.CustomerKey,
+		SSECustomerKeyMD5:       sse.CustomerKeyMD5,
+		SSEKMSKeyId:             sse.KMSKeyID,
+		SSEKMSEncryptionContext: sse.KMSContext,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.UploadId), nil
+}
+
+func (s awsStore) PutObjectPart(bucket, object, uploadID string, partNumber int, data io.Reader, size int64, sse *SSE) (Part, error) {
+	awsSSE := newAWSSSE(sse)
+	output, err := s.client.UploadPart(context.Background(), &awss3.UploadPartInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(object),
+		UploadId:             aws.String(uploadID),
+		PartNumber:           aws.Int32(int32(partNumber)),
+		Body:                 data,
+		ContentLength:        aws.Int64(size),
+		SSECustomerAlgorithm: awsSSE.CustomerAlgorithm,
+		SSECustomerKey:       awsSSE.CustomerKey,
+		SSECustomerKeyMD5:    awsSSE.CustomerKeyMD5,
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{PartNumber: partNumber, ETag: awsETag(output.ETag)}, nil
+}
+
+func (s awsStore) CompleteMultipartUpload(bucket, object, uploadID string, parts []Part) (ObjectInfo, error) {
+	completedParts := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completedParts = append(completedParts, types.CompletedPart{
+			PartNumber: aws.Int32(int32(part.PartNumber)),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	output, err := s.client.CompleteMultipartUpload(context.Background(), &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(object),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:                  object,
+		ETag:                 awsETag(output.ETag),
+		ServerSideEncryption: string(output.ServerSideEncryption),
+		SSEKMSKeyID:          aws.ToString(output.SSEKMSKeyId),
+	}, nil
+}
+
+func (s awsStore) AbortMultipartUpload(bucket, object, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(context.Background(), &awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(object),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// awsSSE contains the aws-sdk-go-v2 request fields
+// of a server-side-encryption. The SSE-C fields are
+// also set for requests which only accept SSE-C.
+type awsSSE struct {
+	Type              types.ServerSideEncryption
+	CustomerAlgorithm *string
+	CustomerKey       *string
+	CustomerKeyMD5    *string
+	KMSKeyID          *string
+	KMSContext        *string
+}
+
+func newAWSSSE(sse *SSE) awsSSE {
+	if sse == nil {
+		return awsSSE{}
+	}
+	switch sse.Type {
+	case SSES3:
+		return awsSSE{Type: types.ServerSideEncryptionAes256}
+	case SSEKMS:
+		s := awsSSE{Type: types.ServerSideEncryptionAwsKms}
+		if sse.KeyID != "" {
+			s.KMSKeyID = aws.String(sse.KeyID)
+		}
+		if context := sse.encodeContext(); context != "" {
+			s.KMSContext = aws.String(context)
+		}
+		return s
+	case SSEC:
+		key, keyMD5 := sse.encodeKey()
+		return awsSSE{
+			CustomerAlgorithm: aws.String("AES256"),
+			CustomerKey:       aws.String(key),
+			CustomerKeyMD5:    aws.String(keyMD5),
+		}
+	default:
+		return awsSSE{}
+	}
+}
+
+func awsETag(etag *string) string { return strings.Trim(aws.ToString(etag), `"`) }
@@ -0,0 +1,556 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unsignedPayload is the payload hash of requests
+// which do not sign the request body.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// ErrorResponse is the error returned by a S3 server.
+type ErrorResponse struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string   `xml:"Code"`
+	Message    string   `xml:"Message"`
+	Resource   string   `xml:"Resource"`
+	BucketName string   `xml:"BucketName"`
+	Key        string   `xml:"Key"`
+	RequestID  string   `xml:"RequestId"`
+	HostID     string   `xml:"HostId"`
+	StatusCode int      `xml:"-"`
+
+	// Region is the region of the bucket if the request has
+	// been sent to or signed for the wrong region - e.g. on
+	// PermanentRedirect or AuthorizationHeaderMalformed errors.
+	Region string `xml:"Region"`
+}
+
+func (e *ErrorResponse) Error() string {
+	if e.Message == "" {
+		return "S3 request failed: " + e.Code
+	}
+	return "S3 request failed: " + e.Code + ": " + e.Message
+}
+
+// NewHTTPStore returns a new Store which sends plain HTTP requests
+// to the endpoint URL - e.g. 'https://localhost:9000'. It signs the
+// requests with AWS signature V4 for the region using the credentials
+// returned by the credentials function - e.g. Config.Credentials.
+// If client is nil, http.DefaultClient is used.
+//
+// The Store uses path-style requests - unless created by Config.NewStore
+// with virtual-host-style addressing - and does not sign the payload
+// of object uploads.
+func NewHTTPStore(endpoint, region string, credentials func() (Credentials, error), client *http.Client) Store {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpStore{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		region:      region,
+		credentials: credentials,
+		client:      client,
+	}
+}
+
+type httpStore struct {
+	endpoint    string
+	region      string
+	credentials func() (Credentials, error)
+	client      *http.Client
+	virtualHost bool // Use virtual-host-style instead of path-style requests
+}
+
+func (*httpStore) Name() string { return StoreHTTP }
+
+func (s *httpStore) ListBuckets() ([]BucketInfo, error) {
+	resp, err := s.do(http.MethodGet, "", "", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Buckets []struct {
+			Name         string    `xml:"Name"`
+			CreationDate time.Time `xml:"CreationDate"`
+		} `xml:"Buckets>Bucket"`
+	}
+	if err = decodeXML(resp, &result); err != nil {
+		return nil, err
+	}
+	buckets := make([]BucketInfo, 0, len(result.Buckets))
+	for _, bucket := range result.Buckets {
+		buckets = append(buckets, BucketInfo{Name: bucket.Name, CreationDate: bucket.CreationDate})
+	}
+	return buckets, nil
+}
+
+func (s *httpStore) BucketExists(bucket string) (bool, error) {
+	resp, err := s.do(http.MethodHead, bucket, "", nil, nil, nil)
+	if err != nil {
+		if errResp, ok := err.(*ErrorResponse); ok && errResp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+func (s *httpStore) MakeBucket(bucket, location string) error {
+	var body []byte
+	if location != "" && location != DefaultRegion {
+		config := struct {
+			XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CreateBucketConfiguration"`
+			LocationConstraint string   `xml:"LocationConstraint"`
+		}{LocationConstraint: location}
+		body, _ = xml.Marshal(config) // Marshaling a struct of strings cannot fail
+	}
+	resp, err := s.do(http.MethodPut, bucket, "", nil, nil, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *httpStore) RemoveBucket(bucket string) error {
+	resp, err := s.do(http.MethodDelete, bucket, "", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *httpStore) GetBucketLocation(bucket string) (string, error) {
+	resp, err := s.do(http.MethodGet, bucket, "", url.Values{"location": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var location struct {
+		LocationConstraint string `xml:",chardata"`
+	}
+	if err = decodeXML(resp, &location); err != nil {
+		return "", err
+	}
+	return bucketRegion(location.LocationConstraint), nil
+}
+
+func (s *httpStore) GetBucketTagging(bucket string) (map[string]string, error) {
+	resp, err := s.do(http.MethodGet, bucket, "", url.Values{"tagging": {""}}, nil, nil)
+	if isAPIError(err, ErrNoSuchTagSet) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Tags []struct {
+			Key   string `xml:"Key"`
+			Value string `xml:"Value"`
+		} `xml:"TagSet>Tag"`
+	}
+	if err = decodeXML(resp, &result); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(result.Tags))
+	for _, tag := range result.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags, nil
+}
+
+func (s *httpStore) PutObject(bucket, object string, data io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	header := make(http.Header)
+	opts.marshal(header)
+	resp, err := s.upload(bucket, object, nil, header, data, size)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+
+	info := httpObjectInfo(object, resp.Header)
+	info.Size = size
+	return info, nil
+}
+
+func (s *httpStore) GetObject(bucket, object string, opts GetOptions) (io.ReadCloser, ObjectInfo, error) {
+	header := make(http.Header)
+	opts.marshal(header)
+	resp, err := s.do(http.MethodGet, bucket, object, nil, header, nil)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return resp.Body, httpObjectInfo(object, resp.Header), nil
+}
+
+func (s *httpStore) StatObject(bucket, object string, opts GetOptions) (ObjectInfo, error) {
+	header := make(http.Header)
+	opts.marshal(header)
+	resp, err := s.do(http.MethodHead, bucket, object, nil, header, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return httpObjectInfo(object, resp.Header), nil
+}
+
+func (s *httpStore) CopyObject(dstBucket, dstObject, srcBucket, srcObject string, opts CopyOptions) error {
+	header := make(http.Header)
+	header.Set("X-Amz-Copy-Source", encodePath("/"+srcBucket+"/"+srcObject))
+	opts.SSE.Marshal(header)
+	opts.SourceSSE.MarshalCopySource(header)
+	if opts.StorageClass != "" {
+		header.Set("X-Amz-Storage-Class", opts.StorageClass)
+	}
+	if opts.Metadata != nil {
+		header.Set("X-Amz-Metadata-Directive", "REPLACE")
+		for k, v := range opts.Metadata {
+			header.Set("X-Amz-Meta-"+k, v)
+		}
+	}
+	resp, err := s.do(http.MethodPut, dstBucket, dstObject, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A copy request may fail after the server has sent the
+	// 200 OK status code. In this case the body contains an
+	// error response.
+	var result struct {
+		ETag string `xml:"ETag"`
+	}
+	return decodeXML(resp, &result)
+}
+
+func (s *httpStore) RemoveObject(bucket, object string) error {
+	resp, err := s.do(http.MethodDelete, bucket, object, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *httpStore) ListObjects(bucket, prefix string) ([]ObjectInfo, error) {
+	var (
+		objects []ObjectInfo
+		token   string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				LastModified time.Time `xml:"LastModified"`
+				ETag         string    `xml:"ETag"`
+				Size         int64     `xml:"Size"`
+				StorageClass string    `xml:"StorageClass"`
+			} `xml:"Contents"`
+		}
+		err = decodeXML(resp, &result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          content.Key,
+				Size:         content.Size,
+				ETag:         strings.Trim(content.ETag, `"`),
+				LastModified: content.LastModified,
+				StorageClass: content.StorageClass,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *httpStore) NewMultipartUpload(bucket, object string, opts PutOptions) (string, error) {
+	header := make(http.Header)
+	opts.marshal(header)
+	resp, err := s.do(http.MethodPost, bucket, object, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err = decodeXML(resp, &result); err != nil {
+		return "", err
+	}
+	return result.UploadID, nil
+}
+
+func (s *httpStore) PutObjectPart(bucket, object, uploadID string, partNumber int, data io.Reader, size int64, sse *SSE) (Part, error) {
+	header := make(http.Header)
+	if sse != nil && sse.Type == SSEC { // Only SSE-C requires headers for each part
+		sse.Marshal(header)
+	}
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}
+	resp, err := s.upload(bucket, object, query, header, data, size)
+	if err != nil {
+		return Part{}, err
+	}
+	resp.Body.Close()
+	return Part{PartNumber: partNumber, ETag: strings.Trim(resp.Header.Get("ETag"), `"`)}, nil
+}
+
+func (s *httpStore) CompleteMultipartUpload(bucket, object, uploadID string, parts []Part) (ObjectInfo, error) {
+	type completePart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	complete := struct {
+		XMLName xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUpload"`
+		Parts   []completePart `xml:"Part"`
+	}{}
+	for _, part := range parts {
+		complete.Parts = append(complete.Parts, completePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp, err := s.do(http.MethodPost, bucket, object, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	}
+	if err = decodeXML(resp, &result); err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: object, ETag: strings.Trim(result.ETag, `"`)}, nil
+}
+
+func (s *httpStore) AbortMultipartUpload(bucket, object, uploadID string) error {
+	resp, err := s.do(http.MethodDelete, bucket, object, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request with the given body to the bucket or object.
+// The body is signed as part of the request. It returns an
+// *ErrorResponse if the server does not respond with a 2xx status
+// code.
+func (s *httpStore) do(method, bucket, object string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := s.newRequest(method, bucket, object, query, header, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	if err = s.sign(req, sha256Hex(body)); err != nil {
+		return nil, err
+	}
+	return s.send(req, bucket, object)
+}
+
+// upload sends a PUT request with the size bytes of data as
+// body to the object. The body is not signed.
+func (s *httpStore) upload(bucket, object string, query url.Values, header http.Header, data io.Reader, size int64) (*http.Response, error) {
+	req, err := s.newRequest(http.MethodPut, bucket, object, query, header, data, size)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.sign(req, unsignedPayload); err != nil {
+		return nil, err
+	}
+	return s.send(req, bucket, object)
+}
+
+func (s *httpStore) newRequest(method, bucket, object string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(method, objectURL(s.endpoint, s.virtualHost, bucket, object), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = query.Encode()
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if size > 0 {
+		req.Body, req.ContentLength = ioutil.NopCloser(io.LimitReader(body, size)), size
+		if r, ok := body.(readSeekerAt); ok {
+			if offset, err := r.Seek(0, io.SeekCurrent); err == nil {
+				req.Body = seekableBody{io.NewSectionReader(r, offset, size)}
+			}
+		}
+	}
+	return req, nil
+}
+
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// seekableBody is a request body which can be rewound - e.g.
+// by a signer which has to compute the payload hash first.
+type seekableBody struct{ *io.SectionReader }
+
+func (seekableBody) Close() error { return nil }
+
+func (s *httpStore) sign(req *http.Request, payloadHash string) error {
+	creds, err := s.credentials()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, creds, s.region, "s3", payloadHash, time.Now())
+	return nil
+}
+
+func (s *httpStore) send(req *http.Request, bucket, object string) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, decodeErrorResponse(resp, bucket, object)
+	}
+	return resp, nil
+}
+
+// splitScheme splits the endpoint URL into its
+// scheme - including '://' - and its host.
+func splitScheme(endpoint string) (scheme, host string) {
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		return endpoint[:i+3], endpoint[i+3:]
+	}
+	return "", endpoint
+}
+
+// decodeErrorResponse returns the S3 error of the response. If the
+// response does not contain a S3 error - e.g. responses to HEAD
+// requests - it derives the error from the status code.
+func decodeErrorResponse(resp *http.Response, bucket, object string) *ErrorResponse {
+	errResp := &ErrorResponse{StatusCode: resp.StatusCode}
+	if body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20)); err == nil && len(body) > 0 {
+		if err = xml.Unmarshal(body, errResp); err == nil && errResp.Code != "" {
+			if errResp.Region == "" {
+				errResp.Region = resp.Header.Get("X-Amz-Bucket-Region")
+			}
+			return errResp
+		}
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		errResp.Code = "NoSuchKey"
+		if object == "" {
+			errResp.Code = "NoSuchBucket"
+		}
+	case http.StatusForbidden:
+		errResp.Code = "AccessDenied"
+	case http.StatusMovedPermanently:
+		errResp.Code = "PermanentRedirect"
+	default:
+		errResp.Code = resp.Status
+	}
+	errResp.BucketName, errResp.Key = bucket, object
+	errResp.RequestID = resp.Header.Get("X-Amz-Request-Id")
+	errResp.Region = resp.Header.Get("X-Amz-Bucket-Region")
+	return errResp
+}
+
+// decodeXML decodes the XML response body into v. It returns an
+// *ErrorResponse if the body contains a S3 error instead.
+func decodeXML(resp *http.Response, v interface{}) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var root struct{ XMLName xml.Name }
+	if err = xml.Unmarshal(body, &root); err != nil {
+		return err
+	}
+	if root.XMLName.Local == "Error" {
+		errResp := &ErrorResponse{StatusCode: resp.StatusCode}
+		if err = xml.Unmarshal(body, errResp); err != nil {
+			return err
+		}
+		return errResp
+	}
+	return xml.Unmarshal(body, v)
+}
+
+func httpObjectInfo(object string, h http.Header) ObjectInfo {
+	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	lastModified, _ := http.ParseTime(h.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:                  object,
+		Size:                 size,
+		ETag:                 strings.Trim(h.Get("ETag"), `"`),
+		LastModified:         lastModified,
+		StorageClass:         h.Get("X-Amz-Storage-Class"),
+		ServerSideEncryption: h.Get("X-Amz-Server-Side-Encryption"),
+		SSECustomerAlgorithm: h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"),
+		SSEKMSKeyID:          h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		SSEKMSContext:        decodeContext(h.Get("X-Amz-Server-Side-Encryption-Context")),
+	}
+}
+
+// marshal adds the HTTP headers of the options to h.
+func (o *PutOptions) marshal(h http.Header) {
+	o.SSE.Marshal(h)
+	if o.StorageClass != "" {
+		h.Set("X-Amz-Storage-Class", o.StorageClass)
+	}
+	for k, v := range o.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+}
+
+// marshal adds the HTTP headers of the options to h.
+func (o *GetOptions) marshal(h http.Header) {
+	if o.SSE != nil && o.SSE.Type == SSEC { // Only SSE-C requires headers for downloads
+		o.SSE.Marshal(h)
+	}
+	if o.Range != "" {
+		h.Set("Range", o.Range)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"errors"
+	"io"
+
+	minio "github.com/minio/minio-go"
+)
+
+// NewMinioStore returns a new Store which uses
+// the minio-go client to send requests.
+func NewMinioStore(client *minio.Client) Store {
+	return minioStore{core: minio.Core{Client: client}}
+}
+
+type minioStore struct {
+	core minio.Core
+}
+
+func (minioStore) Name() string { return StoreMinio }
+
+func (s minioStore) ListBuckets() ([]BucketInfo, error) {
+	infos, err := s.core.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	buckets := make([]BucketInfo, 0, len(infos))
+	for _, info := range infos {
+		buckets = append(buckets, BucketInfo{Name: info.Name, CreationDate: info.CreationDate})
+	}
+	return buckets, nil
+}
+
+func (s minioStore) BucketExists(bucket string) (bool, error) {
+	return s.core.BucketExists(bucket)
+}
+
+func (s minioStore) MakeBucket(bucket, location string) error {
+	return s.core.MakeBucket(bucket, location)
+}
+
+func (s minioStore) RemoveBucket(bucket string) error { return s.core.RemoveBucket(bucket) }
+
+// GetBucketLocation returns the location cached by minio-go
+// if the bucket has been created by the same client.
+func (s minioStore) GetBucketLocation(bucket string) (string, error) {
+	return s.core.GetBucketLocation(bucket)
+}
+
+// GetBucketTagging fails since minio-go v6 does
+// not support bucket tagging.
+func (minioStore) GetBucketTagging(bucket string) (map[string]string, error) {
+	return nil, errors.New("s3: minio-go does not support bucket tagging")
+}
+
+func (s minioStore) PutObject(bucket, object string, data io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	sse, err := opts.SSE.minio()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	metadata := make(map[string]string, len(opts.Metadata)+1)
+	for k, v := range opts.Metadata {
+		metadata[k] = v
+	}
+	if opts.StorageClass != "" {
+		metadata["X-Amz-Storage-Class"] = opts.StorageClass
+	}
+	info, err := s.core.PutObject(bucket, object, data, size, "", "", metadata, sse)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return minioObjectInfo(info), nil
+}
+
+func (s minioStore) GetObject(bucket, object string, opts GetOptions) (io.ReadCloser, ObjectInfo, error) {
+	getOpts, err := minioGetOptions(opts)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	body, info, err := s.core.GetObject(bucket, object, getOpts)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return body, minioObjectInfo(info), nil
+}
+
+func (s minioStore) StatObject(bucket, object string, opts GetOptions) (ObjectInfo, error) {
+	getOpts, err := minioGetOptions(opts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := s.core.StatObject(bucket, object, minio.StatObjectOptions{GetObjectOptions: getOpts})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return minioObjectInfo(info), nil
+}
+
+func (s minioStore) CopyObject(dstBucket, dstObject, srcBucket, srcObject string, opts CopyOptions) error {
+	sse, err := opts.SSE.minio()
+	if err != nil {
+		return err
+	}
+	var srcSSE *SSE
+	if opts.SourceSSE != nil && opts.SourceSSE.Type == SSEC {
+		// minio-go would send the SSE-S3 and SSE-KMS headers
+		// of the source as headers of the destination.
+		srcSSE = opts.SourceSSE
+	}
+	srcEncryption, err := srcSSE.minio()
+	if err != nil {
+		return err
+	}
+	src := minio.NewSourceInfo(srcBucket, srcObject, srcEncryption)
+	if opts.StorageClass != "" {
+		src.Headers.Set("X-Amz-Storage-Class", opts.StorageClass)
+	}
+	dst, err := minio.NewDestinationInfo(dstBucket, dstObject, sse, opts.Metadata)
+	if err != nil {
+		return err
+	}
+	return s.core.Client.CopyObject(dst, src)
+}
+
+func (s minioStore) RemoveObject(bucket, object string) error {
+	return s.core.RemoveObject(bucket, object)
+}
+
+func (s minioStore) ListObjects(bucket, prefix string) ([]ObjectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	var objects []ObjectInfo
+	for info := range s.core.Client.ListObjectsV2(bucket, prefix, true, doneCh) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, minioObjectInfo(info))
+	}
+	return objects, nil
+}
+
+func (s minioStore) NewMultipartUpload(bucket, object string, opts PutOptions) (string, error) {
+	sse, err := opts.SSE.minio()
+	if err != nil {
+		return "", err
+	}
+	return s.core.NewMultipartUpload(bucket, object, minio.PutObjectOptions{
+		ServerSideEncryption: sse,
+		StorageClass:         opts.StorageClass,
+		UserMetadata:         opts.Metadata,
+	})
+}
+
+func (s minioStore) PutObjectPart(bucket, object, uploadID string, partNumber int, data io.Reader, size int64, sse *SSE) (Part, error) {
+	if sse != nil && sse.Type != SSEC {
+		sse = nil // Only SSE-C requires headers for each part
+	}
+	encryption, err := sse.minio()
+	if err != nil {
+		return Part{}, err
+	}
+	part, err := s.core.PutObjectPart(bucket, object, uploadID, partNumber, data, size, "", "", encryption)
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{PartNumber: part.PartNumber, ETag: part.ETag}, nil
+}
+
+func (s minioStore) CompleteMultipartUpload(bucket, object, uploadID string, parts []Part) (ObjectInfo, error) {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	etag, err := s.core.CompleteMultipartUpload(bucket, object, uploadID, completeParts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: object, ETag: etag}, nil
+}
+
+func (s minioStore) AbortMultipartUpload(bucket, object, uploadID string) error {
+	return s.core.AbortMultipartUpload(bucket, object, uploadID)
+}
+
+func minioGetOptions(opts GetOptions) (minio.GetObjectOptions, error) {
+	sse, err := opts.SSE.minio()
+	if err != nil {
+		return minio.GetObjectOptions{}, err
+	}
+	getOpts := minio.GetObjectOptions{ServerSideEncryption: sse}
+	if opts.Range != "" {
+		getOpts.Set("Range", opts.Range)
+	}
+	return getOpts, nil
+}
+
+func minioObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	if info.StorageClass == "" {
+		info.StorageClass = info.Metadata.Get("X-Amz-Storage-Class")
+	}
+	return ObjectInfo{
+		Key:                  info.Key,
+		Size:                 info.Size,
+		ETag:                 info.ETag,
+		LastModified:         info.LastModified,
+		StorageClass:         info.StorageClass,
+		ServerSideEncryption: info.Metadata.Get("X-Amz-Server-Side-Encryption"),
+		SSECustomerAlgorithm: info.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"),
+		SSEKMSKeyID:          info.Metadata.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		SSEKMSContext:        decodeContext(info.Metadata.Get("X-Amz-Server-Side-Encryption-Context")),
+	}
+}
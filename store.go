@@ -0,0 +1,335 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	// StoreMinio is the name of the Store implemented
+	// using minio-go.
+	StoreMinio = "minio-go"
+	// StoreAWS is the name of the Store implemented
+	// using the aws-sdk-go-v2.
+	StoreAWS = "aws-sdk-go"
+	// StoreHTTP is the name of the Store implemented
+	// using plain HTTP requests signed with AWS signature V4.
+	StoreHTTP = "http"
+)
+
+// Stores contains the names of all Store implementations.
+// Config.NewStore can create a Store for each of them.
+var Stores = []string{StoreMinio, StoreAWS, StoreHTTP}
+
+// DefaultRegion is the region used for signing requests
+// if no other region is specified.
+const DefaultRegion = "us-east-1"
+
+// MinPartSize is the min. size of a multipart part -
+// except the last part.
+const MinPartSize = 5 * 1024 * 1024
+
+// MaxPartSize is the max. size of a multipart part.
+// It is also the max. size of an object uploaded
+// within a single request.
+const MaxPartSize = 5 * 1024 * 1024 * 1024
+
+// MaxParts is the max. number of parts of a multipart
+// upload. Valid part numbers are 1 to MaxParts.
+const MaxParts = 10000
+
+// MaxObjectSize is the max. size of an object.
+const MaxObjectSize = 5 * 1024 * 1024 * 1024 * 1024
+
+// Store is a S3 client which is independent of a particular
+// S3 client library. Tests written against a Store can run
+// through every Store implementation to tell whether a failure
+// is caused by the S3 server or by one client library.
+//
+// The bucket methods match the functions expected by MakeBucket,
+// RemoveObject and RemoveBucket such that method values can be
+// passed directly.
+type Store interface {
+	// Name returns the name of the Store implementation.
+	Name() string
+
+	// ListBuckets returns the info of all buckets.
+	ListBuckets() ([]BucketInfo, error)
+	// BucketExists returns true if the bucket exists.
+	BucketExists(bucket string) (bool, error)
+	// MakeBucket creates a new bucket at the location.
+	// If location is empty, the server chooses the location.
+	MakeBucket(bucket, location string) error
+	// RemoveBucket removes the empty bucket.
+	RemoveBucket(bucket string) error
+	// GetBucketLocation returns the region of the bucket.
+	// Buckets without a location constraint are located
+	// in DefaultRegion.
+	GetBucketLocation(bucket string) (string, error)
+	// GetBucketTagging returns the tags of the bucket.
+	// It returns no tags if the bucket has no tag set.
+	GetBucketTagging(bucket string) (map[string]string, error)
+
+	// PutObject uploads the size bytes of data
+	// as object within a single request.
+	PutObject(bucket, object string, data io.Reader, size int64, opts PutOptions) (ObjectInfo, error)
+	// GetObject returns the content and info of the object.
+	// The returned io.ReadCloser must be closed by the caller.
+	GetObject(bucket, object string, opts GetOptions) (io.ReadCloser, ObjectInfo, error)
+	// StatObject returns the info of the object.
+	StatObject(bucket, object string, opts GetOptions) (ObjectInfo, error)
+	// CopyObject copies the source object to the destination
+	// object using a server-side copy.
+	CopyObject(dstBucket, dstObject, srcBucket, srcObject string, opts CopyOptions) error
+	// RemoveObject removes the object.
+	RemoveObject(bucket, object string) error
+	// ListObjects returns the info of all objects
+	// within the bucket which start with prefix.
+	ListObjects(bucket, prefix string) ([]ObjectInfo, error)
+
+	// NewMultipartUpload starts a new multipart upload
+	// and returns its upload ID.
+	NewMultipartUpload(bucket, object string, opts PutOptions) (string, error)
+	// PutObjectPart uploads the size bytes of data as part
+	// of the multipart upload. The SSE must match the SSE
+	// used to start the multipart upload.
+	PutObjectPart(bucket, object, uploadID string, partNumber int, data io.Reader, size int64, sse *SSE) (Part, error)
+	// CompleteMultipartUpload completes the multipart upload.
+	CompleteMultipartUpload(bucket, object, uploadID string, parts []Part) (ObjectInfo, error)
+	// AbortMultipartUpload aborts the multipart upload.
+	AbortMultipartUpload(bucket, object, uploadID string) error
+}
+
+// PutOptions are the options for uploading an object.
+type PutOptions struct {
+	SSE          *SSE
+	StorageClass string
+
+	// Metadata is the user-defined object metadata.
+	// The keys must not contain the 'X-Amz-Meta-' prefix.
+	Metadata map[string]string
+}
+
+// GetOptions are the options for downloading an object.
+type GetOptions struct {
+	SSE *SSE
+
+	// Range is the value of the HTTP Range header -
+	// e.g. 'bytes=0-99'. See: SetRange
+	Range string
+}
+
+// SetRange sets the Range such that only the specified range
+// of the object is downloaded. It follows the semantics of
+// minio-go's GetObjectOptions.SetRange:
+//   - start == 0 && end < 0:  the last -end bytes.
+//   - start > 0 && end == 0:  all bytes starting at start.
+//   - 0 <= start <= end:      all bytes from start to end (inclusive).
+func (o *GetOptions) SetRange(start, end int64) error {
+	switch {
+	case start == 0 && end < 0:
+		o.Range = "bytes=" + strconv.FormatInt(end, 10)
+	case 0 < start && end == 0:
+		o.Range = "bytes=" + strconv.FormatInt(start, 10) + "-"
+	case 0 <= start && start <= end:
+		o.Range = "bytes=" + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10)
+	default:
+		return fmt.Errorf("Invalid range: start=%d end=%d", start, end)
+	}
+	return nil
+}
+
+// CopyOptions are the options for copying an object.
+type CopyOptions struct {
+	// SSE is the server-side-encryption of the destination object.
+	SSE *SSE
+	// SourceSSE is the server-side-encryption of the source object.
+	SourceSSE *SSE
+
+	StorageClass string
+
+	// Metadata replaces the user-defined metadata of the source
+	// object, if not nil. Otherwise, the metadata is copied.
+	Metadata map[string]string
+}
+
+// BucketInfo contains information about a bucket.
+type BucketInfo struct {
+	Name         string
+	CreationDate time.Time
+}
+
+// ObjectInfo contains information about an object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	StorageClass string
+
+	// ServerSideEncryption is the value of the
+	// X-Amz-Server-Side-Encryption response header -
+	// e.g. 'AES256' or 'aws:kms'.
+	ServerSideEncryption string
+	// SSECustomerAlgorithm is the value of the
+	// X-Amz-Server-Side-Encryption-Customer-Algorithm
+	// response header.
+	SSECustomerAlgorithm string
+	// SSEKMSKeyID is the value of the
+	// X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id
+	// response header.
+	SSEKMSKeyID string
+	// SSEKMSContext is the decoded SSE-KMS encryption context
+	// of the X-Amz-Server-Side-Encryption-Context response
+	// header. S3 only returns it for some operations - e.g.
+	// PutObject - and only if the request specified a context.
+	SSEKMSContext map[string]string
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// PutMultipartObject uploads the size bytes of data as object
+// using a multipart upload with parts of partSize bytes. It
+// aborts the multipart upload if any part cannot be uploaded.
+//
+// The parts are streamed from data without buffering them. If
+// data implements io.ReaderAt and io.Seeker - e.g. the Reader of
+// a Payload or a bytes.Reader - each part is an io.SectionReader
+// of data such that a Store can seek within the part, e.g. to
+// sign it.
+func PutMultipartObject(store Store, bucket, object string, data io.Reader, size, partSize int64, opts PutOptions) (ObjectInfo, error) {
+	if partSize < MinPartSize {
+		return ObjectInfo{}, errors.New("The part size must be at least " + strconv.Itoa(MinPartSize) + " bytes")
+	}
+	seekerAt, seekable := data.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+	var offset int64
+	if seekable {
+		var err error
+		if offset, err = seekerAt.Seek(0, io.SeekCurrent); err != nil {
+			return ObjectInfo{}, err
+		}
+	}
+	uploadID, err := store.NewMultipartUpload(bucket, object, opts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	var parts []Part
+	for partNumber := 1; size > 0 || partNumber == 1; partNumber++ {
+		n := partSize
+		if size < n {
+			n = size
+		}
+		var body io.Reader = &io.LimitedReader{R: data, N: n}
+		if seekable {
+			body = io.NewSectionReader(seekerAt, offset, n)
+		}
+		part, err := store.PutObjectPart(bucket, object, uploadID, partNumber, body, n, opts.SSE)
+		if lr, ok := body.(*io.LimitedReader); ok && err == nil && lr.N > 0 {
+			err = io.ErrUnexpectedEOF // The store has not read the entire part
+		}
+		if err != nil {
+			store.AbortMultipartUpload(bucket, object, uploadID)
+			return ObjectInfo{}, err
+		}
+		parts = append(parts, part)
+		offset, size = offset+n, size-n
+	}
+	if seekable {
+		if _, err = seekerAt.Seek(offset, io.SeekStart); err != nil {
+			store.AbortMultipartUpload(bucket, object, uploadID)
+			return ObjectInfo{}, err
+		}
+	}
+	return store.CompleteMultipartUpload(bucket, object, uploadID, parts)
+}
+
+// NewStore returns a new Store for the endpoint. The name must be
+// one of Stores. The Store uses the credentials, the addressing style,
+// the TLS configuration and the transport hook of the config. It fails
+// the test if the Store cannot be created.
+func (c *Config) NewStore(t testing.TB, name string) Store {
+	switch name {
+	case StoreMinio:
+		return NewMinioStore(c.NewClient(t))
+	case StoreAWS:
+		return NewAWSStore(c.newAWSClient(t))
+	case StoreHTTP:
+		store, err := c.HTTPStore()
+		if err != nil {
+			t.Fatalf("Failed to create transport for '%s': %v", c.Endpoint, err)
+		}
+		return store
+	default:
+		t.Fatalf("Unknown store '%s'", name)
+		return nil
+	}
+}
+
+// HTTPStore returns a new HTTP Store for the endpoint - like
+// NewStore(t, StoreHTTP). It can be used outside of tests - e.g.
+// by commands. It returns an error if the transport for the
+// endpoint cannot be created.
+func (c *Config) HTTPStore() (Store, error) {
+	transport, err := c.wrappedTransport()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: c.newSigner(transport)}
+	store := NewHTTPStore(c.url(), c.region(), c.Credentials, client).(*httpStore)
+	store.virtualHost = c.Addressing == AddressingVirtualHost
+	return store, nil
+}
+
+// RunStores runs f as subtest for every Store implementation.
+func (c *Config) RunStores(t *testing.T, f func(*testing.T, Store)) {
+	for _, name := range Stores {
+		t.Run(name, func(t *testing.T) { f(t, c.NewStore(t, name)) })
+	}
+}
+
+// RunStores runs f as subtest for every target and every
+// Store implementation.
+func (targets Targets) RunStores(t *testing.T, f func(*testing.T, Config, Store)) {
+	targets.Run(t, func(t *testing.T, config Config) {
+		config.RunStores(t, func(t *testing.T, store Store) { f(t, config, store) })
+	})
+}
+
+// bucketRegion returns the region of a bucket with the given
+// location constraint. S3 returns an empty location constraint
+// for buckets in us-east-1 and 'EU' for legacy buckets in eu-west-1.
+func bucketRegion(locationConstraint string) string {
+	switch locationConstraint {
+	case "":
+		return DefaultRegion
+	case "EU":
+		return "eu-west-1"
+	default:
+		return locationConstraint
+	}
+}
+
+// url returns the URL of the endpoint.
+func (c *Config) url() string {
+	if c.Secure() {
+		return "https://" + c.Endpoint
+	}
+	return "http://" + c.Endpoint
+}
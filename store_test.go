@@ -0,0 +1,594 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aead/s3"
+)
+
+// memObject is an object stored by the memS3 server.
+type memObject struct {
+	Data   []byte
+	Header http.Header // The SSE and storage class response headers
+	KeyMD5 string      // The MD5 of the SSE-C key, if any
+}
+
+// memVersion is a noncurrent object version or a delete
+// marker stored by the memS3 server.
+type memVersion struct {
+	Key          string
+	VersionID    string
+	DeleteMarker bool
+}
+
+// memS3 is a minimal in-memory S3 server. It implements
+// just enough of the S3 API to test the Store implementations.
+type memS3 struct {
+	region string // The region of the server. Requests must be signed for it.
+
+	lock      sync.Mutex
+	buckets   map[string]map[string]memObject
+	locations map[string]string
+	created   map[string]time.Time
+	tags      map[string][]byte // The tagging XML of every bucket.
+	uploads   map[string]map[int][]byte
+	uploadIDs map[string]map[string]string // The upload IDs of every bucket and their object.
+	versioned map[string]bool              // The buckets with versioning enabled.
+	versions  map[string][]memVersion      // The noncurrent versions and delete markers of every bucket.
+	versionID int                          // The ID of the last version.
+}
+
+func newMemS3(region string) *memS3 {
+	return &memS3{
+		region:    region,
+		buckets:   map[string]map[string]memObject{},
+		locations: map[string]string{},
+		created:   map[string]time.Time{},
+		tags:      map[string][]byte{},
+		uploads:   map[string]map[int][]byte{},
+		uploadIDs: map[string]map[string]string{},
+		versioned: map[string]bool{},
+		versions:  map[string][]memVersion{},
+	}
+}
+
+func (s *memS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if code != "" {
+		xml.NewEncoder(w).Encode(s3.ErrorResponse{Code: code, Message: code})
+	}
+}
+
+func (s *memS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	authorization := r.Header.Get("Authorization")
+	signatureV4 := strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=access-key/")
+	if !signatureV4 && !strings.HasPrefix(authorization, "AWS access-key:") {
+		s.writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	resource := strings.TrimPrefix(r.URL.Path, "/")
+	if host, _, err := net.SplitHostPort(r.Host); err == nil && strings.HasSuffix(host, ".localhost") {
+		resource = strings.TrimSuffix(host, ".localhost") + "/" + resource // virtual-host-style request
+	}
+	path := strings.SplitN(resource, "/", 2)
+	bucket, query := path[0], r.URL.Query()
+
+	// Like S3, accept GetBucketLocation requests signed for any region.
+	scope := strings.Split(authorization, "/")
+	if signatureV4 && len(query["location"]) == 0 && scope[2] != s.region {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusBadRequest)
+		xml.NewEncoder(w).Encode(s3.ErrorResponse{Code: "AuthorizationHeaderMalformed", Region: s.region})
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if len(path) == 1 || path[1] == "" {
+		s.serveBucket(w, r, bucket, query)
+		return
+	}
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := path[1]
+
+	switch {
+	case r.Method == http.MethodPost && query.Get("uploadId") == "" && len(query["uploads"]) > 0:
+		uploadID := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[uploadID] = map[int][]byte{}
+		s.uploadIDs[bucket][uploadID] = key
+		objects[key] = s.newObject(r, nil)
+		xml.NewEncoder(w).Encode(struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: uploadID})
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		data, _ := ioutil.ReadAll(r.Body)
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		s.uploads[query.Get("uploadId")][partNumber] = data
+		w.Header().Set("ETag", `"`+strconv.Itoa(partNumber)+`"`)
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		parts := s.uploads[query.Get("uploadId")]
+		var numbers []int
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		object := objects[key]
+		for _, number := range numbers {
+			object.Data = append(object.Data, parts[number]...)
+		}
+		objects[key] = object
+		delete(s.uploads, query.Get("uploadId"))
+		delete(s.uploadIDs[bucket], query.Get("uploadId"))
+		xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string   `xml:"Bucket"`
+			Key     string   `xml:"Key"`
+			ETag    string   `xml:"ETag"`
+		}{Bucket: bucket, Key: key, ETag: `"multipart"`})
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		delete(s.uploads, query.Get("uploadId"))
+		delete(s.uploadIDs[bucket], query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		src := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+		object, ok := s.buckets[src[0]][src[1]]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if object.KeyMD5 != r.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-MD5") {
+			s.writeError(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		objects[key] = s.newObject(r, object.Data)
+		xml.NewEncoder(w).Encode(struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string   `xml:"ETag"`
+		}{ETag: `"copy"`})
+	case r.Method == http.MethodPut:
+		if _, ok := objects[key]; ok {
+			s.addVersion(bucket, key, false)
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		objects[key] = s.newObject(r, data)
+		for _, k := range []string{"X-Amz-Server-Side-Encryption", "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"} {
+			if v := objects[key].Header.Get(k); v != "" {
+				w.Header().Set(k, v)
+			}
+		}
+		if context := r.Header.Get("X-Amz-Server-Side-Encryption-Context"); context != "" {
+			w.Header().Set("X-Amz-Server-Side-Encryption-Context", context)
+		}
+		sum := md5.Sum(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := objects[key]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if object.KeyMD5 != r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-MD5") {
+			s.writeError(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		for k, v := range object.Header {
+			w.Header()[k] = v
+		}
+		sum := md5.Sum(object.Data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		http.ServeContent(w, r, key, time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(object.Data))
+	case r.Method == http.MethodDelete && query.Get("versionId") != "" && query.Get("versionId") != "null":
+		versions := s.versions[bucket][:0]
+		for _, version := range s.versions[bucket] {
+			if version.Key != key || version.VersionID != query.Get("versionId") {
+				versions = append(versions, version)
+			}
+		}
+		s.versions[bucket] = versions
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		if _, ok := objects[key]; ok && query.Get("versionId") == "" {
+			s.addVersion(bucket, key, false)
+		}
+		if query.Get("versionId") == "" {
+			s.addVersion(bucket, key, true)
+		}
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *memS3) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, query url.Values) {
+	objects, ok := s.buckets[bucket]
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		type bucketInfo struct {
+			Name         string    `xml:"Name"`
+			CreationDate time.Time `xml:"CreationDate"`
+		}
+		result := struct {
+			XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+			Buckets []bucketInfo `xml:"Buckets>Bucket"`
+		}{}
+		for name := range s.buckets {
+			result.Buckets = append(result.Buckets, bucketInfo{name, s.created[name]})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case ok && r.Method == http.MethodPut && len(query["tagging"]) > 0:
+		s.tags[bucket], _ = ioutil.ReadAll(r.Body)
+	case ok && r.Method == http.MethodPut && len(query["versioning"]) > 0:
+		var config struct {
+			Status string `xml:"Status"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+			s.writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		s.versioned[bucket] = config.Status == "Enabled"
+	case r.Method == http.MethodPut:
+		var config struct {
+			LocationConstraint string `xml:"LocationConstraint"`
+		}
+		xml.NewDecoder(r.Body).Decode(&config)
+		if location := config.LocationConstraint; location != s.region && (location != "" || s.region != s3.DefaultRegion) {
+			s.writeError(w, http.StatusBadRequest, "IllegalLocationConstraintException")
+			return
+		}
+		s.buckets[bucket] = map[string]memObject{}
+		s.locations[bucket] = config.LocationConstraint
+		s.created[bucket] = time.Now().UTC()
+		s.uploadIDs[bucket] = map[string]string{}
+	case !ok:
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket")
+	case r.Method == http.MethodHead:
+	case r.Method == http.MethodDelete:
+		if len(objects) > 0 || len(s.versions[bucket]) > 0 || len(s.uploadIDs[bucket]) > 0 {
+			s.writeError(w, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(s.buckets, bucket)
+		delete(s.locations, bucket)
+		delete(s.created, bucket)
+		delete(s.tags, bucket)
+		delete(s.uploadIDs, bucket)
+		delete(s.versioned, bucket)
+		delete(s.versions, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	case len(query["location"]) > 0:
+		xml.NewEncoder(w).Encode(struct {
+			XMLName  xml.Name `xml:"LocationConstraint"`
+			Location string   `xml:",chardata"`
+		}{Location: s.locations[bucket]})
+	case len(query["tagging"]) > 0:
+		if len(s.tags[bucket]) == 0 {
+			s.writeError(w, http.StatusNotFound, "NoSuchTagSet")
+			return
+		}
+		w.Write(s.tags[bucket])
+	case len(query["uploads"]) > 0:
+		type upload struct {
+			Key      string `xml:"Key"`
+			UploadID string `xml:"UploadId"`
+		}
+		result := struct {
+			XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+			Uploads []upload `xml:"Upload"`
+		}{}
+		for uploadID, key := range s.uploadIDs[bucket] {
+			result.Uploads = append(result.Uploads, upload{key, uploadID})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case len(query["versions"]) > 0:
+		type version struct {
+			Key       string `xml:"Key"`
+			VersionID string `xml:"VersionId"`
+		}
+		result := struct {
+			XMLName       xml.Name  `xml:"ListVersionsResult"`
+			Versions      []version `xml:"Version"`
+			DeleteMarkers []version `xml:"DeleteMarker"`
+		}{}
+		for key := range objects {
+			result.Versions = append(result.Versions, version{key, "null"})
+		}
+		for _, v := range s.versions[bucket] {
+			if v.DeleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, version{v.Key, v.VersionID})
+			} else {
+				result.Versions = append(result.Versions, version{v.Key, v.VersionID})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		type content struct {
+			Key          string `xml:"Key"`
+			Size         int    `xml:"Size"`
+			StorageClass string `xml:"StorageClass"`
+		}
+		result := struct {
+			XMLName  xml.Name  `xml:"ListBucketResult"`
+			Name     string    `xml:"Name"`
+			Contents []content `xml:"Contents"`
+		}{Name: bucket}
+		for key, object := range objects {
+			if strings.HasPrefix(key, query.Get("prefix")) {
+				result.Contents = append(result.Contents, content{key, len(object.Data), object.Header.Get("X-Amz-Storage-Class")})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	default:
+		s.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readBody returns the request body. It decodes chunked payloads
+// of requests using streaming signatures and checks their length.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return body, err
+	}
+
+	var (
+		data   []byte
+		reader = bufio.NewReader(bytes.NewReader(body))
+	)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(header), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size+2) // The chunk data is followed by '\r\n'
+		if _, err = io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+	if length := r.Header.Get("X-Amz-Decoded-Content-Length"); length != strconv.Itoa(len(data)) {
+		return nil, errors.New("Decoded content length mismatch")
+	}
+	return data, nil
+}
+
+// addVersion adds a noncurrent version of the object or a
+// delete marker to the bucket if its versioning is enabled.
+func (s *memS3) addVersion(bucket, key string, deleteMarker bool) {
+	if !s.versioned[bucket] {
+		return
+	}
+	s.versionID++
+	s.versions[bucket] = append(s.versions[bucket], memVersion{
+		Key:          key,
+		VersionID:    strconv.Itoa(s.versionID),
+		DeleteMarker: deleteMarker,
+	})
+}
+
+// newObject returns a new object with the data and the
+// SSE and storage class headers of the request.
+func (s *memS3) newObject(r *http.Request, data []byte) memObject {
+	object := memObject{Data: data, Header: http.Header{}}
+	object.Header.Set("X-Amz-Storage-Class", "STANDARD")
+	if class := r.Header.Get("X-Amz-Storage-Class"); class != "" {
+		object.Header.Set("X-Amz-Storage-Class", class)
+	}
+	if sse := r.Header.Get("X-Amz-Server-Side-Encryption"); sse != "" {
+		object.Header.Set("X-Amz-Server-Side-Encryption", sse)
+	}
+	if r.Header.Get("X-Amz-Server-Side-Encryption") == "aws:kms" {
+		keyID := r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+		if keyID == "" {
+			keyID = "default-key"
+		}
+		object.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "arn:aws:kms:"+keyID)
+	}
+	if keyMD5 := r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-MD5"); keyMD5 != "" {
+		object.KeyMD5 = keyMD5
+		object.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+		object.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key-MD5", keyMD5)
+	}
+	return object
+}
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-stores")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	rootCAs, err := s3.GenerateCerts(dir)
+	if err != nil {
+		t.Fatalf("Failed to generate certificates: %s", err)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, s3.PublicCertFile), filepath.Join(dir, s3.PrivateKeyFile))
+	if err != nil {
+		t.Fatalf("Failed to load generated certificate: %s", err)
+	}
+
+	const region = "eu-west-1"
+	server := httptest.NewUnstartedServer(newMemS3(region))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to parse server address: %s", err)
+	}
+
+	// Virtual-host-style requests to 'bucket.localhost' are sent to
+	// the server since the endpoint is 'localhost'.
+	var (
+		lock         sync.Mutex
+		virtualHosts = map[string]bool{}
+		signatures   = map[string]bool{}
+	)
+	targets := s3.Targets{"memS3": s3.Config{
+		Endpoint:   net.JoinHostPort("localhost", port),
+		Region:     region,
+		Addressing: s3.AddressingBoth,
+		Signature:  s3.SignatureAll,
+		AccessKey:  "access-key",
+		SecretKey:  "secret-key",
+		RootCAs:    rootCAs,
+		WrapTransport: func(transport http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				lock.Lock()
+				if host := req.URL.Hostname(); strings.HasSuffix(host, ".localhost") {
+					virtualHosts[host] = true
+				}
+				if strings.HasPrefix(req.Header.Get("Authorization"), "AWS ") {
+					signatures[string(s3.SignatureV2)] = true
+				}
+				signatures[req.Header.Get("X-Amz-Content-Sha256")] = true
+				lock.Unlock()
+				return transport.RoundTrip(req)
+			})
+		},
+	}}
+	defer func() {
+		if n := len(s3.Stores) * len(s3.Signatures); len(virtualHosts) != n {
+			t.Fatalf("Sent virtual-host-style requests for %d buckets but expected %d", len(virtualHosts), n)
+		}
+		for _, signature := range []string{string(s3.SignatureV2), "UNSIGNED-PAYLOAD", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"} {
+			if !signatures[signature] {
+				t.Fatalf("No request has been signed using '%s'", signature)
+			}
+		}
+	}()
+	targets.RunStores(t, func(t *testing.T, config s3.Config, store s3.Store) {
+		bucket := s3.BucketName("test-" + store.Name())
+		if remove, err := s3.MakeBucketAt(bucket, config.Region, store.BucketExists, store.MakeBucket, store.RemoveBucket); err != nil {
+			t.Fatalf("Failed to create bucket '%s': %s", bucket, err)
+		} else {
+			defer remove(t)
+		}
+		if location, err := store.GetBucketLocation(bucket); err != nil || location != region {
+			t.Fatalf("Invalid bucket location: got '%s' - want '%s' - err: %v", location, region, err)
+		}
+		buckets, err := store.ListBuckets()
+		if err != nil {
+			t.Fatalf("Failed to list buckets: %v", err)
+		}
+		found := false
+		for _, info := range buckets {
+			found = found || (info.Name == bucket && !info.CreationDate.IsZero())
+		}
+		if !found {
+			t.Fatalf("Bucket '%s' is not listed: %+v", bucket, buckets)
+		}
+
+		data, sse := []byte("Hello World"), mustNewSSEC(make([]byte, 32))
+		if _, err := store.PutObject(bucket, "object-1", bytes.NewReader(data), int64(len(data)), s3.PutOptions{SSE: sse, StorageClass: "REDUCED_REDUNDANCY"}); err != nil {
+			t.Fatalf("Failed to upload object: %v", err)
+		}
+		if _, err := store.StatObject(bucket, "object-1", s3.GetOptions{}); err == nil {
+			t.Fatal("Stat without SSE-C key should fail but succeeded")
+		}
+		info, err := store.StatObject(bucket, "object-1", s3.GetOptions{SSE: sse})
+		if err != nil {
+			t.Fatalf("Failed to stat object: %v", err)
+		}
+		if info.Size != int64(len(data)) || info.SSECustomerAlgorithm != "AES256" || info.StorageClass != "REDUCED_REDUNDANCY" {
+			t.Fatalf("Invalid object info: %+v", info)
+		}
+
+		opts := s3.GetOptions{SSE: sse}
+		opts.SetRange(6, 0)
+		if content, err := getObject(store, bucket, "object-1", opts); err != nil || string(content) != "World" {
+			t.Fatalf("Failed to get object range: got '%s' - err: %v", content, err)
+		}
+
+		if err = store.CopyObject(bucket, "object-2", bucket, "object-1", s3.CopyOptions{SourceSSE: sse, SSE: s3.NewSSES3()}); err != nil {
+			t.Fatalf("Failed to copy object: %v", err)
+		}
+		if info, err = store.StatObject(bucket, "object-2", s3.GetOptions{}); err != nil || info.ServerSideEncryption != "AES256" {
+			t.Fatalf("Failed to stat object: %+v - err: %v", info, err)
+		}
+
+		kms := s3.NewSSEKMS("my-key", map[string]string{"purpose": "s3-test"})
+		if info, err = store.PutObject(bucket, "object-4", bytes.NewReader(data), int64(len(data)), s3.PutOptions{SSE: kms}); err != nil {
+			t.Fatalf("Failed to upload object: %v", err)
+		}
+		if store.Name() != s3.StoreMinio && info.SSEKMSContext["purpose"] != "s3-test" { // minio-go does not expose the response headers
+			t.Fatalf("Invalid SSE-KMS context: %v", info.SSEKMSContext)
+		}
+		if info, err = store.StatObject(bucket, "object-4", s3.GetOptions{SSE: kms}); err != nil || info.ServerSideEncryption != "aws:kms" || info.SSEKMSKeyID != "arn:aws:kms:my-key" {
+			t.Fatalf("Failed to stat object: %+v - err: %v", info, err)
+		}
+
+		data = randomData(t, s3.MinPartSize+1)
+		if _, err = s3.PutMultipartObject(store, bucket, "object-3", bytes.NewReader(data), int64(len(data)), s3.MinPartSize, s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to upload multipart object: %v", err)
+		}
+		if content, err := getObject(store, bucket, "object-3", s3.GetOptions{}); err != nil || !bytes.Equal(content, data) {
+			t.Fatalf("Failed to get multipart object - err: %v", err)
+		}
+		if _, err = s3.PutMultipartObject(store, bucket, "object-5", io.MultiReader(bytes.NewReader(data)), int64(len(data)), s3.MinPartSize, s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to upload multipart object from a non-seekable reader: %v", err)
+		}
+		if content, err := getObject(store, bucket, "object-5", s3.GetOptions{}); err != nil || !bytes.Equal(content, data) {
+			t.Fatalf("Failed to get multipart object - err: %v", err)
+		}
+
+		objects, err := store.ListObjects(bucket, "object-")
+		if err != nil {
+			t.Fatalf("Failed to list objects: %v", err)
+		}
+		if len(objects) != 5 {
+			t.Fatalf("Listed %d objects but expected %d", len(objects), 5)
+		}
+		for _, object := range objects {
+			s3.RemoveObject(bucket, object.Key, store.RemoveObject, t)
+		}
+
+		_, err = store.StatObject(bucket, "object-1", s3.GetOptions{})
+		s3.ExpectStatus(t, err, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefreshWindow is the time before the credentials
+	// expire at which new credentials are retrieved.
+	DefaultRefreshWindow = 5 * time.Minute
+
+	// DefaultRoleSessionName is the role session name used for
+	// STS requests if no session name is specified explicitly.
+	DefaultRoleSessionName = "s3-test"
+
+	stsVersion = "2011-06-15"
+)
+
+// A CredentialsProvider retrieves (temporary) S3 credentials.
+type CredentialsProvider interface {
+	// Retrieve returns new credentials and the point in
+	// time when they expire. A zero expiration time indicates
+	// that the credentials never expire.
+	Retrieve() (Credentials, time.Time, error)
+}
+
+// RefreshCredentials returns a CredentialsProvider which caches
+// the credentials retrieved from p and only retrieves new credentials
+// once the cached credentials expire within the window.
+//
+// The returned CredentialsProvider is safe for concurrent use.
+func RefreshCredentials(p CredentialsProvider, window time.Duration) CredentialsProvider {
+	return &refreshingProvider{
+		provider: p,
+		window:   window,
+		now:      time.Now,
+	}
+}
+
+type refreshingProvider struct {
+	provider CredentialsProvider
+	window   time.Duration
+	now      func() time.Time
+
+	lock       sync.Mutex
+	creds      Credentials
+	expiration time.Time
+	valid      bool
+}
+
+func (p *refreshingProvider) Retrieve() (Credentials, time.Time, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.valid && (p.expiration.IsZero() || p.now().Add(p.window).Before(p.expiration)) {
+		return p.creds, p.expiration, nil
+	}
+	creds, expiration, err := p.provider.Retrieve()
+	if err != nil {
+		p.valid = false
+		return Credentials{}, time.Time{}, err
+	}
+	p.creds, p.expiration, p.valid = creds, expiration, true
+	return creds, expiration, nil
+}
+
+// AssumeRole is a CredentialsProvider which obtains temporary
+// credentials from a STS endpoint using the AssumeRole API.
+type AssumeRole struct {
+	// Endpoint is the URL of the STS endpoint - e.g. 'https://sts.amazonaws.com'.
+	Endpoint string
+	// Region is the region of the STS endpoint used to
+	// sign STS requests. If not set 'us-east-1' is used.
+	Region string
+	// Credentials are the long-term credentials used to
+	// sign STS requests.
+	Credentials Credentials
+	// RoleARN is the ARN of the role to assume.
+	RoleARN string
+	// RoleSessionName identifies the assumed role session.
+	// If not set DefaultRoleSessionName is used.
+	RoleSessionName string
+	// Duration is the lifetime of the temporary credentials.
+	// If not set the STS endpoint chooses the lifetime.
+	Duration time.Duration
+	// Client is the HTTP client used to send STS requests.
+	// If not set http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Retrieve obtains new temporary credentials from the STS endpoint.
+func (a *AssumeRole) Retrieve() (Credentials, time.Time, error) {
+	form := stsForm("AssumeRole", a.RoleARN, a.RoleSessionName, a.Duration)
+	req, err := http.NewRequest(http.MethodPost, a.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	region := a.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	signV4(req, a.Credentials, region, "sts", sha256Hex([]byte(form.Encode())), time.Now())
+
+	var response struct {
+		Result stsResult `xml:"AssumeRoleResult"`
+	}
+	if err = doSTSRequest(a.Client, req, &response); err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	return response.Result.Credentials.credentials()
+}
+
+// AssumeRoleWithWebIdentity is a CredentialsProvider which obtains
+// temporary credentials from a STS endpoint in exchange for an
+// OpenID Connect ID token using the AssumeRoleWithWebIdentity API.
+type AssumeRoleWithWebIdentity struct {
+	// Endpoint is the URL of the STS endpoint - e.g. 'https://sts.amazonaws.com'.
+	Endpoint string
+	// Token returns the OpenID Connect ID token issued
+	// by the identity provider.
+	Token func() (string, error)
+	// RoleARN is the ARN of the role to assume.
+	RoleARN string
+	// RoleSessionName identifies the assumed role session.
+	// If not set DefaultRoleSessionName is used.
+	RoleSessionName string
+	// Duration is the lifetime of the temporary credentials.
+	// If not set the STS endpoint chooses the lifetime.
+	Duration time.Duration
+	// Client is the HTTP client used to send STS requests.
+	// If not set http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Retrieve obtains new temporary credentials from the STS endpoint.
+func (a *AssumeRoleWithWebIdentity) Retrieve() (Credentials, time.Time, error) {
+	if a.Token == nil {
+		return Credentials{}, time.Time{}, errors.New("No web identity token is provided")
+	}
+	token, err := a.Token()
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+
+	form := stsForm("AssumeRoleWithWebIdentity", a.RoleARN, a.RoleSessionName, a.Duration)
+	form.Set("WebIdentityToken", token)
+	req, err := http.NewRequest(http.MethodPost, a.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response struct {
+		Result stsResult `xml:"AssumeRoleWithWebIdentityResult"`
+	}
+	if err = doSTSRequest(a.Client, req, &response); err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	return response.Result.Credentials.credentials()
+}
+
+// WebIdentityTokenFile returns a function which reads a web
+// identity token from the file at path. The file is read on
+// every call such that rotated tokens are picked up.
+func WebIdentityTokenFile(path string) func() (string, error) {
+	return func() (string, error) {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+// stsConfig describes how a target obtains temporary
+// credentials from a STS endpoint.
+type stsConfig struct {
+	Endpoint             string `json:"endpoint" yaml:"endpoint"`
+	RoleARN              string `json:"role_arn" yaml:"role_arn"`
+	RoleSessionName      string `json:"role_session_name" yaml:"role_session_name"`
+	WebIdentityTokenFile string `json:"web_identity_token_file" yaml:"web_identity_token_file"`
+	DurationSeconds      int    `json:"duration_seconds" yaml:"duration_seconds"`
+}
+
+// enabled returns true if the target should obtain
+// temporary credentials from a STS endpoint.
+func (s *stsConfig) enabled() bool { return s.RoleARN != "" || s.WebIdentityTokenFile != "" }
+
+// provider returns a CredentialsProvider for the config which
+// obtains temporary credentials from the STS endpoint. If no
+// STS endpoint is specified the S3 endpoint of the config is
+// used. Without a web identity token file the provider assumes
+// the role using the static credentials of the config.
+func (s *stsConfig) provider(config *Config) (CredentialsProvider, error) {
+	if s.WebIdentityTokenFile == "" && (config.AccessKey == "" || config.SecretKey == "") {
+		return nil, errors.New("AssumeRole requires an access key and a secret key")
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = config.url()
+	}
+	transport, err := config.Transport()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport}
+	duration := time.Duration(s.DurationSeconds) * time.Second
+
+	if s.WebIdentityTokenFile != "" {
+		return RefreshCredentials(&AssumeRoleWithWebIdentity{
+			Endpoint:        endpoint,
+			Token:           WebIdentityTokenFile(s.WebIdentityTokenFile),
+			RoleARN:         s.RoleARN,
+			RoleSessionName: s.RoleSessionName,
+			Duration:        duration,
+			Client:          client,
+		}, DefaultRefreshWindow), nil
+	}
+	return RefreshCredentials(&AssumeRole{
+		Endpoint: endpoint,
+		Region:   config.region(),
+		Credentials: Credentials{
+			AccessKey:    config.AccessKey,
+			SecretKey:    config.SecretKey,
+			SessionToken: config.SessionToken,
+		},
+		RoleARN:         s.RoleARN,
+		RoleSessionName: s.RoleSessionName,
+		Duration:        duration,
+		Client:          client,
+	}, DefaultRefreshWindow), nil
+}
+
+// STSError is the error returned by a STS endpoint.
+type STSError struct {
+	Type       string `xml:"Error>Type"`
+	Code       string `xml:"Error>Code"`
+	Message    string `xml:"Error>Message"`
+	RequestID  string `xml:"RequestId"`
+	StatusCode int    `xml:"-"`
+}
+
+func (e *STSError) Error() string {
+	if e.Message == "" {
+		return "STS request failed: " + e.Code
+	}
+	return "STS request failed: " + e.Code + ": " + e.Message
+}
+
+type stsResult struct {
+	Credentials stsCredentials `xml:"Credentials"`
+}
+
+type stsCredentials struct {
+	AccessKey    string    `xml:"AccessKeyId"`
+	SecretKey    string    `xml:"SecretAccessKey"`
+	SessionToken string    `xml:"SessionToken"`
+	Expiration   time.Time `xml:"Expiration"`
+}
+
+func (c *stsCredentials) credentials() (Credentials, time.Time, error) {
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return Credentials{}, time.Time{}, errors.New("The STS response does not contain credentials")
+	}
+	return Credentials{
+		AccessKey:    c.AccessKey,
+		SecretKey:    c.SecretKey,
+		SessionToken: c.SessionToken,
+	}, c.Expiration, nil
+}
+
+func stsForm(action, roleARN, sessionName string, duration time.Duration) url.Values {
+	if sessionName == "" {
+		sessionName = DefaultRoleSessionName
+	}
+	form := url.Values{}
+	form.Set("Action", action)
+	form.Set("Version", stsVersion)
+	form.Set("RoleSessionName", sessionName)
+	if roleARN != "" {
+		form.Set("RoleArn", roleARN)
+	}
+	if duration > 0 {
+		form.Set("DurationSeconds", strconv.Itoa(int(duration/time.Second)))
+	}
+	return form
+}
+
+func doSTSRequest(client *http.Client, req *http.Request, response interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		stsErr := &STSError{StatusCode: resp.StatusCode}
+		if err = xml.Unmarshal(body, stsErr); err != nil || stsErr.Code == "" {
+			stsErr.Code = resp.Status
+		}
+		return stsErr
+	}
+	return xml.Unmarshal(body, response)
+}
@@ -0,0 +1,439 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// oidcServer is an in-process OpenID Connect identity
+// provider which issues RS256 signed ID tokens and serves
+// its public key as JSON web key set.
+type oidcServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	audience string
+}
+
+func newOIDCServer(t *testing.T, audience string) *oidcServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %s", err)
+	}
+	s := &oidcServer{key: key, audience: audience}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   s.URL,
+				"jwks_uri": s.URL + "/jwks",
+			})
+		case "/jwks":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kty": "RSA",
+					"alg": "RS256",
+					"use": "sig",
+					"kid": "1",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s
+}
+
+// IssueToken returns an ID token for the subject which expires after
+// the given duration and is signed with the given key - or the key of
+// the identity provider if key is nil.
+func (s *oidcServer) IssueToken(t *testing.T, subject string, expiry time.Duration, key *rsa.PrivateKey) string {
+	if key == nil {
+		key = s.key
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "1"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": s.URL,
+		"sub": subject,
+		"aud": s.audience,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(expiry).Unix(),
+	})
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %s", err)
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// verifyToken verifies the ID token using the JSON web key
+// set of the identity provider at issuer.
+func verifyToken(token, issuer, audience string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errors.New("malformed token signature")
+	}
+
+	resp, err := http.Get(issuer + "/jwks")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var jwks struct {
+		Keys []struct{ N, E string } `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil || len(jwks.Keys) == 0 {
+		return errors.New("invalid JSON web key set")
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].E)
+	publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return errors.New("invalid token signature")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return errors.New("malformed token claims")
+	}
+	var claims struct {
+		Issuer   string `json:"iss"`
+		Audience string `json:"aud"`
+		Expiry   int64  `json:"exp"`
+	}
+	if err = json.Unmarshal(claimsJSON, &claims); err != nil {
+		return errors.New("malformed token claims")
+	}
+	if claims.Issuer != issuer || claims.Audience != audience {
+		return errors.New("invalid token issuer or audience")
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		return errExpiredToken
+	}
+	return nil
+}
+
+var errExpiredToken = errors.New("token is expired")
+
+// stsServer is an in-process STS endpoint which implements the
+// AssumeRole and AssumeRoleWithWebIdentity APIs. It verifies the
+// signature of AssumeRole requests and the ID token of
+// AssumeRoleWithWebIdentity requests against an OpenID Connect
+// identity provider.
+type stsServer struct {
+	*httptest.Server
+	users    map[string]string // access key -> secret key
+	region   string            // The region of the credential scope.
+	issuer   string
+	audience string
+
+	lock   sync.Mutex
+	issued int
+}
+
+func newSTSServer(users map[string]string, oidc *oidcServer) *stsServer {
+	s := &stsServer{users: users, region: "us-east-1"}
+	if oidc != nil {
+		s.issuer, s.audience = oidc.URL, oidc.audience
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Issued returns the number of issued temporary credentials.
+func (s *stsServer) Issued() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.issued
+}
+
+func (s *stsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeSTSError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err = r.ParseForm(); err != nil {
+		writeSTSError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	switch r.PostForm.Get("Action") {
+	case "AssumeRole":
+		if code, err := s.verifySignature(r, body); err != nil {
+			writeSTSError(w, http.StatusForbidden, code, err.Error())
+			return
+		}
+	case "AssumeRoleWithWebIdentity":
+		switch err := verifyToken(r.PostForm.Get("WebIdentityToken"), s.issuer, s.audience); {
+		case err == errExpiredToken:
+			writeSTSError(w, http.StatusBadRequest, "ExpiredTokenException", "Token expired")
+			return
+		case err != nil:
+			writeSTSError(w, http.StatusBadRequest, "InvalidIdentityToken", err.Error())
+			return
+		}
+	default:
+		writeSTSError(w, http.StatusBadRequest, "InvalidAction", "Unsupported action")
+		return
+	}
+
+	duration := time.Hour
+	if seconds := r.PostForm.Get("DurationSeconds"); seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil || n < 900 {
+			writeSTSError(w, http.StatusBadRequest, "ValidationError", "Invalid DurationSeconds")
+			return
+		}
+		duration = time.Duration(n) * time.Second
+	}
+
+	s.lock.Lock()
+	s.issued++
+	n := s.issued
+	s.lock.Unlock()
+
+	action := r.PostForm.Get("Action")
+	credentials, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Credentials"`
+		stsCredentials
+	}{
+		stsCredentials: stsCredentials{
+			AccessKey:    "ASIA" + strconv.Itoa(n),
+			SecretKey:    "temporary-secret-" + strconv.Itoa(n),
+			SessionToken: "session-token-" + strconv.Itoa(n),
+			Expiration:   time.Now().Add(duration).UTC(),
+		},
+	})
+	body = []byte(`<` + action + `Response xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><` + action + `Result>` +
+		string(credentials) + `</` + action + `Result></` + action + `Response>`)
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(body)
+}
+
+func (s *stsServer) verifySignature(r *http.Request, body []byte) (string, error) {
+	auth := r.Header.Get("Authorization")
+	const prefix = signV4Algorithm + " Credential="
+	if !strings.HasPrefix(auth, prefix) {
+		return "MissingAuthenticationToken", errors.New("Request is missing Authentication Token")
+	}
+	accessKey := strings.SplitN(strings.TrimPrefix(auth, prefix), "/", 2)[0]
+	secretKey, ok := s.users[accessKey]
+	if !ok {
+		return "InvalidClientTokenId", errors.New("The security token included in the request is invalid")
+	}
+	date, err := time.Parse(iso8601Format, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return "IncompleteSignature", errors.New("Invalid X-Amz-Date")
+	}
+
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	if token := r.Header.Get("X-Amz-Security-Token"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, Credentials{AccessKey: accessKey, SecretKey: secretKey}, s.region, "sts", sha256Hex(body), date)
+	if req.Header.Get("Authorization") != auth {
+		return "SignatureDoesNotMatch", errors.New("The request signature we calculated does not match the signature you provided")
+	}
+	return "", nil
+}
+
+func writeSTSError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ErrorResponse"`
+		Type    string   `xml:"Error>Type"`
+		Code    string   `xml:"Error>Code"`
+		Message string   `xml:"Error>Message"`
+	}{Type: "Sender", Code: code, Message: message})
+}
+
+var assumeRoleTests = []struct {
+	Credentials Credentials
+	Duration    time.Duration
+	ErrCode     string
+}{
+	{Credentials: Credentials{AccessKey: "access-key", SecretKey: "secret-key"}},                                                    // 0
+	{Credentials: Credentials{AccessKey: "access-key", SecretKey: "secret-key"}, Duration: 15 * time.Minute},                        // 1
+	{Credentials: Credentials{AccessKey: "access-key", SecretKey: "secret-key"}, Duration: time.Minute, ErrCode: "ValidationError"}, // 2
+	{Credentials: Credentials{AccessKey: "access-key", SecretKey: "wrong-secret-key"}, ErrCode: "SignatureDoesNotMatch"},            // 3
+	{Credentials: Credentials{AccessKey: "unknown-key", SecretKey: "secret-key"}, ErrCode: "InvalidClientTokenId"},                  // 4
+}
+
+func TestAssumeRole(t *testing.T) {
+	server := newSTSServer(map[string]string{"access-key": "secret-key"}, nil)
+	defer server.Close()
+
+	for i, test := range assumeRoleTests {
+		provider := &AssumeRole{
+			Endpoint:    server.URL,
+			Credentials: test.Credentials,
+			RoleARN:     "arn:aws:iam::123456789012:role/s3-test",
+			Duration:    test.Duration,
+		}
+		creds, expiration, err := provider.Retrieve()
+		if test.ErrCode != "" {
+			if stsErr, ok := err.(*STSError); !ok || stsErr.Code != test.ErrCode {
+				t.Errorf("Test %d: Should fail with '%s' but failed with: %v", i, test.ErrCode, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Failed to assume role: %s", i, err)
+			continue
+		}
+		if creds.AccessKey == "" || creds.SecretKey == "" || creds.SessionToken == "" {
+			t.Errorf("Test %d: Incomplete temporary credentials: %v", i, creds)
+		}
+		duration := test.Duration
+		if duration == 0 {
+			duration = time.Hour
+		}
+		if d := expiration.Sub(time.Now()); d > duration || d < duration-time.Minute {
+			t.Errorf("Test %d: Credentials expire in %v - want %v", i, d, duration)
+		}
+	}
+}
+
+func TestSTSConfigRegion(t *testing.T) {
+	server := newSTSServer(map[string]string{"access-key": "secret-key"}, nil)
+	server.region = "eu-west-1"
+	defer server.Close()
+
+	sts := stsConfig{Endpoint: server.URL, RoleARN: "arn:aws:iam::123456789012:role/s3-test"}
+	config := Config{Endpoint: "localhost:9000", Region: server.region, AccessKey: "access-key", SecretKey: "secret-key"}
+	provider, err := sts.provider(&config)
+	if err != nil {
+		t.Fatalf("Failed to create STS credentials provider: %v", err)
+	}
+	if _, _, err = provider.Retrieve(); err != nil {
+		t.Fatalf("Failed to assume role in region '%s': %v", server.region, err)
+	}
+}
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	oidc := newOIDCServer(t, "s3-test")
+	defer oidc.Close()
+	server := newSTSServer(nil, oidc)
+	defer server.Close()
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %s", err)
+	}
+	var tests = []struct {
+		Token   string
+		ErrCode string
+	}{
+		{Token: oidc.IssueToken(t, "user", time.Hour, nil)},                                       // 0
+		{Token: oidc.IssueToken(t, "user", -time.Minute, nil), ErrCode: "ExpiredTokenException"},  // 1
+		{Token: oidc.IssueToken(t, "user", time.Hour, otherKey), ErrCode: "InvalidIdentityToken"}, // 2
+		{Token: "not-a-token", ErrCode: "InvalidIdentityToken"},                                   // 3
+	}
+	for i, test := range tests {
+		token := test.Token
+		provider := &AssumeRoleWithWebIdentity{
+			Endpoint: server.URL,
+			Token:    func() (string, error) { return token, nil },
+			RoleARN:  "arn:aws:iam::123456789012:role/s3-test",
+		}
+		creds, _, err := provider.Retrieve()
+		if test.ErrCode != "" {
+			if stsErr, ok := err.(*STSError); !ok || stsErr.Code != test.ErrCode {
+				t.Errorf("Test %d: Should fail with '%s' but failed with: %v", i, test.ErrCode, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Failed to assume role with web identity: %s", i, err)
+			continue
+		}
+		if creds.AccessKey == "" || creds.SecretKey == "" || creds.SessionToken == "" {
+			t.Errorf("Test %d: Incomplete temporary credentials: %v", i, creds)
+		}
+	}
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	server := newSTSServer(map[string]string{"access-key": "secret-key"}, nil)
+	defer server.Close()
+
+	now := time.Now()
+	provider := RefreshCredentials(&AssumeRole{
+		Endpoint:    server.URL,
+		Credentials: Credentials{AccessKey: "access-key", SecretKey: "secret-key"},
+		Duration:    time.Hour,
+	}, DefaultRefreshWindow).(*refreshingProvider)
+	provider.now = func() time.Time { return now }
+
+	first, _, err := provider.Retrieve()
+	if err != nil {
+		t.Fatalf("Failed to retrieve credentials: %s", err)
+	}
+	now = now.Add(30 * time.Minute)
+	if creds, _, err := provider.Retrieve(); err != nil || creds != first {
+		t.Fatalf("Credentials were refreshed before expiry: %v %v", creds, err)
+	}
+	if n := server.Issued(); n != 1 {
+		t.Fatalf("STS server issued %d credentials - want 1", n)
+	}
+
+	// The credentials expire within the refresh window.
+	now = now.Add(26 * time.Minute)
+	second, _, err := provider.Retrieve()
+	if err != nil {
+		t.Fatalf("Failed to refresh credentials: %s", err)
+	}
+	if second == first {
+		t.Fatal("Credentials were not refreshed within the refresh window")
+	}
+	if n := server.Issued(); n != 2 {
+		t.Fatalf("STS server issued %d credentials - want 2", n)
+	}
+
+	// The minio-go credentials must pick up refreshed credentials.
+	now = time.Now()
+	config := Config{Endpoint: "localhost:9000", Provider: provider}
+	value, err := config.MinioCredentials().Get()
+	if err != nil {
+		t.Fatalf("Failed to get minio credentials: %s", err)
+	}
+	if value.AccessKeyID != second.AccessKey || value.SessionToken != second.SessionToken {
+		t.Fatalf("minio credentials mismatch: got %v - want %v", value, second)
+	}
+	now = now.Add(time.Hour)
+	if value, err = config.MinioCredentials().Get(); err != nil || value.AccessKeyID == second.AccessKey {
+		t.Fatalf("minio credentials were not refreshed: %v %v", value, err)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// bucketNamePattern matches the bucket names returned by BucketName:
+// '<prefix>-<run ID>-<hex>'. The first submatch is the run ID.
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]*[a-z0-9])?-([0-9a-f]{8})-[0-9a-f]{8}$`)
+
+// SweepOptions are the options for Sweep.
+type SweepOptions struct {
+	// Prefix restricts Sweep to buckets with names
+	// starting with Prefix - e.g. 'test-'. Either
+	// Prefix or RunID must be set.
+	Prefix string
+	// RunID restricts Sweep to buckets created by a
+	// particular test run - i.e. tagged with the run ID
+	// or, if the bucket has no tags, with the run ID as
+	// part of their name. See: RunID
+	RunID string
+	// OlderThan restricts Sweep to buckets created
+	// more than OlderThan ago.
+	OlderThan time.Duration
+	// DryRun, if true, makes Sweep only return the
+	// buckets it would remove without removing them.
+	DryRun bool
+
+	// Remove removes a bucket recursively - e.g.
+	// Config.ForceRemoveBucket. If nil, Sweep removes all
+	// objects listed by the Store before removing the bucket.
+	Remove func(bucket string) error
+}
+
+// Sweep removes test buckets which have been left behind - e.g.
+// by crashed test runs. A bucket is a test bucket if it has been
+// tagged with a run ID by Config.MakeBucket or Config.TagBucket
+// and, if its name has been generated by BucketName, the name
+// contains the same run ID. A bucket without any tags - e.g. on
+// servers which don't implement bucket tagging or if tagging the
+// bucket failed - is a test bucket if its name has been generated
+// by BucketName. Sweep returns the names of the removed buckets -
+// or of the buckets it would remove on a dry run.
+//
+// Sweep requires a Prefix or a RunID such that it never considers
+// all buckets of the server. It tries to remove all matching buckets
+// and returns the first error it encounters. It stops when the ctx
+// is canceled.
+func Sweep(ctx context.Context, store Store, opts SweepOptions) ([]string, error) {
+	if opts.Prefix == "" && opts.RunID == "" {
+		return nil, errors.New("Sweep requires a bucket name prefix or a run ID")
+	}
+	buckets, err := store.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	remove := opts.Remove
+	if remove == nil {
+		remove = func(bucket string) error { return removeBucketRecursive(store, bucket) }
+	}
+
+	var (
+		removed  []string
+		firstErr error
+	)
+	for _, bucket := range buckets {
+		if err = ctx.Err(); err != nil {
+			return removed, err
+		}
+		if !strings.HasPrefix(bucket.Name, opts.Prefix) {
+			continue
+		}
+		if opts.OlderThan > 0 && time.Since(bucket.CreationDate) < opts.OlderThan {
+			continue
+		}
+		if !isTestBucket(store, bucket.Name, opts.RunID) {
+			continue
+		}
+		if !opts.DryRun {
+			if err = remove(bucket.Name); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+		removed = append(removed, bucket.Name)
+	}
+	return removed, firstErr
+}
+
+// isTestBucket returns true if the bucket has been created by
+// a test run - with the given run ID, if not empty. The run ID
+// tag of the bucket identifies the test run. If the bucket name
+// has been generated by BucketName, it must contain the same run
+// ID. If the bucket has no tags at all - e.g. since the server
+// does not implement bucket tagging or the test run failed to tag
+// the bucket - the bucket name identifies the test run on its own.
+func isTestBucket(store Store, bucket, runID string) bool {
+	match := bucketNamePattern.FindStringSubmatch(bucket)
+	tags, err := store.GetBucketTagging(bucket)
+	if isAPIError(err, ErrNotImplemented) || isAPIError(err, ErrNoSuchTagSet) || (err == nil && len(tags) == 0) {
+		return match != nil && (runID == "" || match[1] == runID)
+	}
+	if err != nil {
+		return false
+	}
+	id, ok := tags[TagRunID]
+	if !ok || (runID != "" && id != runID) {
+		return false
+	}
+	return match == nil || match[1] == id
+}
+
+// removeBucketRecursive removes all objects within
+// the bucket and then the bucket itself.
+func removeBucketRecursive(store Store, bucket string) error {
+	objects, err := store.ListObjects(bucket, "")
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err = store.RemoveObject(bucket, object.Key); err != nil {
+			return err
+		}
+	}
+	return store.RemoveBucket(bucket)
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aead/s3"
+)
+
+var sweepTests = []struct {
+	Options    s3.SweepOptions
+	ThisRun    bool  // Restrict the sweep to the ID of this run.
+	Removed    []int // The indices of the removed buckets.
+	ShouldFail bool
+}{
+	{ // 0
+		Options: s3.SweepOptions{Prefix: "test-", OlderThan: time.Hour},
+		Removed: nil,
+	},
+	{ // 1
+		Options: s3.SweepOptions{Prefix: "other-", DryRun: true},
+		Removed: []int{2},
+	},
+	{ // 2
+		Options: s3.SweepOptions{DryRun: true},
+		ThisRun: true,
+		Removed: []int{0, 1, 2, 3, 5},
+	},
+	{ // 3
+		Options: s3.SweepOptions{RunID: "00000000", DryRun: true},
+		Removed: nil,
+	},
+	{ // 4
+		Options: s3.SweepOptions{Prefix: "test-"},
+		Removed: []int{0, 1, 5},
+	},
+	{ // 5
+		Options: s3.SweepOptions{},
+		ThisRun: true,
+		Removed: []int{2, 3},
+	},
+	{ // 6
+		Options: s3.SweepOptions{Prefix: "test-"},
+		Removed: nil,
+	},
+	{ // 7
+		Options:    s3.SweepOptions{DryRun: true},
+		ShouldFail: true,
+	},
+}
+
+func TestSweep(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := config.NewStore(t, s3.StoreHTTP)
+
+	// The first five buckets are tagged with the run ID. The fifth
+	// one has a name with another run ID and must not be removed.
+	// The sixth one has not been tagged - e.g. since the test run
+	// crashed before tagging it - but its name identifies the run.
+	buckets := []string{
+		s3.BucketName("test-sweep"), s3.BucketName("test-sweep"), s3.BucketName("other-sweep"), "tagged-bucket", "test-sweep-00000000-00000000",
+		s3.BucketName("test-untagged"), "keep-me", "test-keep-me", "test-backups-20240101", "test-backups-deadbeef",
+	}
+	for i, bucket := range buckets {
+		if err := store.MakeBucket(bucket, region); err != nil {
+			t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+		}
+		if i <= 4 {
+			config.TagBucket(t, bucket)
+		}
+		data := []byte("Hello World")
+		if _, err := store.PutObject(bucket, "object-1", bytes.NewReader(data), int64(len(data)), s3.PutOptions{}); err != nil {
+			t.Fatalf("Failed to create object '%s/object-1': %v", bucket, err)
+		}
+	}
+
+	for i, test := range sweepTests {
+		if test.ThisRun {
+			test.Options.RunID = s3.RunID()
+		}
+		removed, err := s3.Sweep(context.Background(), store, test.Options)
+		if err != nil && !test.ShouldFail {
+			t.Fatalf("Test %d: Failed to sweep buckets: %v", i, err)
+		}
+		if err == nil && test.ShouldFail {
+			t.Fatalf("Test %d: Sweeping buckets should fail but succeeded", i)
+		}
+		var want []string
+		for _, j := range test.Removed {
+			want = append(want, buckets[j])
+		}
+		sort.Strings(removed)
+		sort.Strings(want)
+		if strings.Join(removed, ",") != strings.Join(want, ",") {
+			t.Fatalf("Test %d: Removed buckets mismatch: got %v - want %v", i, removed, want)
+		}
+		for _, bucket := range removed {
+			if ok, err := store.BucketExists(bucket); ok || err != nil {
+				if !test.Options.DryRun {
+					t.Fatalf("Test %d: Bucket '%s' has not been removed - err: %v", i, bucket, err)
+				}
+			} else if test.Options.DryRun {
+				t.Fatalf("Test %d: Bucket '%s' has been removed on a dry run", i, bucket)
+			}
+		}
+	}
+
+	for _, bucket := range append([]string{buckets[4]}, buckets[6:]...) {
+		if ok, err := store.BucketExists(bucket); !ok || err != nil {
+			t.Fatalf("Bucket '%s' should not be removed - err: %v", bucket, err)
+		}
+	}
+}
+
+// noTaggingStore is a Store of a server which
+// does not implement bucket tagging.
+type noTaggingStore struct{ s3.Store }
+
+func (noTaggingStore) GetBucketTagging(string) (map[string]string, error) {
+	return nil, &s3.ErrorResponse{Code: s3.ErrNotImplemented.Code}
+}
+
+func TestSweepWithoutTagging(t *testing.T) {
+	const region = "eu-west-1"
+	server := httptest.NewServer(newMemS3(region))
+	defer server.Close()
+
+	config := s3.Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    region,
+		NoTLS:     true,
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+	}
+	store := noTaggingStore{config.NewStore(t, s3.StoreHTTP)}
+
+	// Without bucket tagging only the bucket names identify test buckets.
+	buckets := []string{s3.BucketName("test-sweep"), "test-sweep-00000000-00000000", "test-keep-me", "test-backups-20240101"}
+	for _, bucket := range buckets {
+		if err := store.MakeBucket(bucket, region); err != nil {
+			t.Fatalf("Failed to create bucket '%s': %v", bucket, err)
+		}
+		defer store.RemoveBucket(bucket)
+	}
+
+	removed, err := s3.Sweep(context.Background(), store, s3.SweepOptions{Prefix: "test-", RunID: s3.RunID(), DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to sweep buckets: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != buckets[0] {
+		t.Fatalf("Removed buckets mismatch: got %v - want %v", removed, buckets[:1])
+	}
+
+	removed, err = s3.Sweep(context.Background(), store, s3.SweepOptions{Prefix: "test-", DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to sweep buckets: %v", err)
+	}
+	want := []string{buckets[0], buckets[1]}
+	sort.Strings(removed)
+	sort.Strings(want)
+	if strings.Join(removed, ",") != strings.Join(want, ",") {
+		t.Fatalf("Removed buckets mismatch: got %v - want %v", removed, want)
+	}
+}
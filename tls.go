@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TLSConfig returns the TLS client configuration for the endpoint.
+// It verifies the server certificate using the RootCAs, the CA
+// certificates in the CACert file or - if neither is set - the
+// system root CAs. If the config specifies a client certificate
+// and private key, the client authenticates itself using them.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		RootCAs:            c.RootCAs,
+	}
+	if c.CACert != "" {
+		if c.RootCAs != nil {
+			return nil, errors.New("Only one of RootCAs and CACert must be specified")
+		}
+		pool, err := loadCertPool(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, errors.New("Both, a client certificate and a private key must be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, errors.New("Failed to load client certificate: " + err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Transport returns a new HTTP transport for the endpoint
+// which uses the TLS configuration of the config.
+//
+// If the endpoint is 'localhost' - or a subdomain of it - the
+// transport connects to the endpoint when dialing any subdomain
+// of the endpoint. Virtual-host-style requests - e.g. to
+// 'bucket.localhost:9000' - work without a DNS entry per bucket.
+func (c *Config) Transport() (*http.Transport, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           c.dialContext(dialer),
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}, nil
+}
+
+// dialContext returns a dial function which connects to the endpoint
+// instead of a subdomain of the endpoint if the endpoint is a local
+// hostname. Otherwise, it returns dialer.DialContext.
+func (c *Config) dialContext(dialer *net.Dialer) func(context.Context, string, string) (net.Conn, error) {
+	host := c.Endpoint
+	if h, _, err := net.SplitHostPort(c.Endpoint); err == nil {
+		host = h
+	}
+	if host != "localhost" && !strings.HasSuffix(host, ".localhost") {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if h, port, err := net.SplitHostPort(address); err == nil && strings.HasSuffix(h, "."+host) {
+			address = net.JoinHostPort(host, port)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// loadCertPool returns a certificate pool containing all
+// PEM-encoded certificates of the file at path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("The CA file '" + path + "' does not contain any PEM-encoded certificates")
+	}
+	return pool, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2018 Andreas Auernhammer. All rights reserved.
+// Use of this source code is governed by a license that can be
+// found in the LICENSE file.
+
+package s3_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aead/s3"
+)
+
+// testPKI is a private CA with a server certificate for
+// 127.0.0.1 and a client certificate - all written as
+// PEM files to a temp. directory.
+type testPKI struct {
+	Dir string
+
+	CA         *x509.Certificate
+	CAFile     string
+	Server     tls.Certificate
+	ClientCert string
+	ClientKey  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "s3-tls")
+	if err != nil {
+		t.Fatalf("Failed to create temp. directory: %s", err)
+	}
+	pki := &testPKI{Dir: dir}
+
+	caDER, caKey := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "s3 test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	if pki.CA, err = x509.ParseCertificate(caDER); err != nil {
+		t.Fatalf("Failed to parse CA certificate: %s", err)
+	}
+	pki.CAFile = pki.writePEM(t, "ca.crt", "CERTIFICATE", caDER)
+
+	serverDER, serverKey := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, pki.CA, caKey)
+	pki.Server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "s3 test client"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, pki.CA, caKey)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("Failed to encode private key: %s", err)
+	}
+	pki.ClientCert = pki.writePEM(t, "client.crt", "CERTIFICATE", clientDER)
+	pki.ClientKey = pki.writePEM(t, "client.key", "EC PRIVATE KEY", keyDER)
+	return pki
+}
+
+func (pki *testPKI) Close() { os.RemoveAll(pki.Dir) }
+
+func (pki *testPKI) writePEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(pki.Dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write '%s': %s", path, err)
+	}
+	return path
+}
+
+// newTestCert creates a certificate from the template signed by the parent
+// and its key. If parent is nil the certificate is self-signed.
+func newTestCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate private key: %s", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatalf("Failed to generate serial number: %s", err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	return der, key
+}
+
+func newTLSServer(pki *testPKI, clientAuth tls.ClientAuthType) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(pki.CA)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.Server},
+		ClientAuth:   clientAuth,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	return server
+}
+
+func TestTLSConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(pki.CA)
+
+	var tests = []struct {
+		Config     s3.Config
+		ClientAuth tls.ClientAuthType
+		ShouldFail bool
+	}{
+		{Config: s3.Config{CACert: pki.CAFile}},                       // 0
+		{Config: s3.Config{RootCAs: rootCAs}},                         // 1
+		{Config: s3.Config{}, ShouldFail: true},                       // 2 Unknown CA
+		{Config: s3.Config{Insecure: true}},                           // 3
+		{Config: s3.Config{CACert: pki.ClientCert}, ShouldFail: true}, // 4 Wrong CA
+		{Config: s3.Config{CACert: pki.CAFile, ClientCert: pki.ClientCert, ClientKey: pki.ClientKey}, ClientAuth: tls.RequireAndVerifyClientCert}, // 5
+		{Config: s3.Config{CACert: pki.CAFile}, ClientAuth: tls.RequireAndVerifyClientCert, ShouldFail: true},                                     // 6 Missing client cert
+		{Config: s3.Config{Insecure: true}, ClientAuth: tls.RequireAndVerifyClientCert, ShouldFail: true},                                         // 7 Missing client cert
+	}
+	for i, test := range tests {
+		server := newTLSServer(pki, test.ClientAuth)
+		transport, err := test.Config.Transport()
+		if err != nil {
+			server.Close()
+			t.Fatalf("Test %d: Failed to create transport: %s", i, err)
+		}
+		client := &http.Client{Transport: transport}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		server.Close()
+
+		if err != nil && !test.ShouldFail {
+			t.Errorf("Test %d: Request failed: %s", i, err)
+		}
+		if err == nil && test.ShouldFail {
+			t.Errorf("Test %d: Request should fail but succeeded", i)
+		}
+	}
+}
+
+func TestInvalidTLSConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	defer pki.Close()
+
+	var tests = []s3.Config{
+		{CACert: filepath.Join(pki.Dir, "does-not-exist")}, // 0
+		{CACert: pki.ClientKey},                            // 1 No certificate
+		{CACert: pki.CAFile, RootCAs: x509.NewCertPool()},  // 2 Both, CACert and RootCAs
+		{ClientCert: pki.ClientCert},                       // 3 No private key
+		{ClientKey: pki.ClientKey},                         // 4 No certificate
+		{ClientCert: pki.CAFile, ClientKey: pki.ClientKey}, // 5 Key mismatch
+	}
+	for i, config := range tests {
+		if _, err := config.TLSConfig(); err == nil {
+			t.Errorf("Test %d: Invalid TLS config should be rejected", i)
+		}
+	}
+}